@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdConfig = &cobra.Command{
+		Use:   "config",
+		Short: "inspect goprompt configuration",
+	}
+	cmdConfigDump = &cobra.Command{
+		Use:   "dump",
+		Short: "print the effective (defaults + config file) configuration",
+	}
+)
+
+func init() {
+	cmdConfig.AddCommand(cmdConfigDump)
+	cmdConfigDump.RunE = cmdConfigDumpRun
+}
+
+func cmdConfigDumpRun(_ *cobra.Command, _ []string) error {
+	if cfgErr != nil {
+		return fmt.Errorf("config %v: %w", configPath(), cfgErr)
+	}
+
+	fmt.Printf("# config: %v\n\n", configPath())
+	return toml.NewEncoder(os.Stdout).Encode(cfg)
+}
@@ -4,17 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
-	"os/user"
-	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
-	"github.com/shirou/gopsutil/v3/process"
 	"github.com/sourcegraph/conc/pool"
 	"github.com/spf13/cobra"
 )
@@ -26,7 +25,7 @@ var (
 	}
 	flgQCmdStatus = cmdQuery.PersistentFlags().String(
 		"cmd-status", "0",
-		"cmd status of previous command (int)",
+		"cmd status of previous command (int), or the status of each command of the pipeline separated by spaces, commas or pipes",
 	)
 	flgQPreexecTS = cmdQuery.PersistentFlags().String(
 		"preexec-ts", "0",
@@ -34,7 +33,7 @@ var (
 	)
 	flgQTimeout = cmdQuery.PersistentFlags().Duration(
 		"timeout", 0,
-		"timeout after which to give up",
+		"timeout after which to give up on all providers (see query.timeouts config for per provider timeouts)",
 	)
 	flgQPidParentSkip = cmdQuery.PersistentFlags().Int(
 		"pid-parent-skip", 0,
@@ -44,14 +43,26 @@ var (
 		"pid-chain", false,
 		"add extra pid parent chain information",
 	)
+	flgQEnable = cmdQuery.PersistentFlags().StringSlice(
+		"enable", nil,
+		"only run these providers (comma separated, default all)",
+	)
+	flgQDisable = cmdQuery.PersistentFlags().StringSlice(
+		"disable", nil,
+		"do not run these providers (comma separated)",
+	)
+	flgQServer = cmdQuery.PersistentFlags().Bool(
+		"server", false,
+		"run the query through goprompt serve (falls back to a local query if it is not running)",
+	)
 )
 
 func init() {
 	cmdQuery.RunE = cmdQueryRun
 }
 
-func mkWgPool() pool.ContextPool {
-	return *pool.New().WithContext(bgctx)
+func mkWgPool(ctx context.Context) pool.ContextPool {
+	return *pool.New().WithContext(ctx)
 }
 
 const (
@@ -59,6 +70,13 @@ const (
 	_partTimestamp = "ts"
 	_partDuration  = "ds"
 
+	// The status of each command of a pipeline is reported as st_pipe
+	// (space separated) and st_pipe_<index>, as raw codes that are decoded
+	// when rendering.
+	_partStatusPipe = "st_pipe"
+	// The name of the signal that killed the last command, if any.
+	_partStatusSig = "st_signal"
+
 	_partOS = "os_name"
 
 	_partWorkDir      = "wd"
@@ -78,6 +96,9 @@ const (
 	_partPidChain       = "pid_chain"
 	_partPidChainLength = "pid_chain_length"
 
+	// Suffix of the per provider state part (e.g. "git_state").
+	_partProviderStateSuffix = "_state"
+
 	_partSessionUsername = "session_username"
 	_partSessionHostname = "session_hostname"
 
@@ -94,18 +115,103 @@ const (
 	_partVcsStgTop   = "vcs_git_stg_top"
 	_partVcsStgDirty = "vcs_git_stg_dirty"
 
-	_partVcsGitRebaseOp   = "vcs_git_rebase_op"
-	_partVcsGitRebaseLeft = "vcs_git_rebase_op_left"
+	_partVcsStgUnapplied = "vcs_git_stg_unapplied"
+	_partVcsStgHidden    = "vcs_git_stg_hidden"
+	_partVcsStgBranch    = "vcs_git_stg_branch"
+
+	_partVcsGitRebaseOp    = "vcs_git_rebase_op"
+	_partVcsGitRebaseLeft  = "vcs_git_rebase_op_left"
+	_partVcsGitRebaseStep  = "vcs_git_rebase_op_step"
+	_partVcsGitRebaseTotal = "vcs_git_rebase_op_total"
+
+	_partVcsGitUpstream = "vcs_git_upstream"
+	_partVcsGitStash    = "vcs_git_stash"
+
+	_partVcsGitDetached = "vcs_git_detached"
+	_partVcsGitSha      = "vcs_git_sha"
+	_partVcsGitTag      = "vcs_git_tag"
+
+	_partVcsGitWorktree  = "vcs_git_worktree"
+	_partVcsGitSubmodule = "vcs_git_submodule"
+	_partVcsGitBare      = "vcs_git_bare"
+	_partVcsGitInGitDir  = "vcs_git_in_gitdir"
 
 	_partVcsGitIdxTotal    = "vcs_git_idx_total"
 	_partVcsGitIdxIncluded = "vcs_git_idx_incl"
 	_partVcsGitIdxExcluded = "vcs_git_idx_excl"
 
+	_partVcsGitIdxStaged     = "vcs_git_idx_staged"
+	_partVcsGitIdxUnstaged   = "vcs_git_idx_unstaged"
+	_partVcsGitIdxUntracked  = "vcs_git_idx_untracked"
+	_partVcsGitIdxConflicted = "vcs_git_idx_conflicted"
+	_partVcsGitIdxRenamed    = "vcs_git_idx_renamed"
+
+	_partVcsHgNode     = "vcs_hg_node"
+	_partVcsHgPhase    = "vcs_hg_phase"
+	_partVcsHgBookmark = "vcs_hg_bookmark"
+	_partVcsHgTopic    = "vcs_hg_topic"
+
+	_partVcsJJChange    = "vcs_jj_change"
+	_partVcsJJCommit    = "vcs_jj_commit"
+	_partVcsJJBookmarks = "vcs_jj_bookmarks"
+	_partVcsJJEmpty     = "vcs_jj_empty"
+	_partVcsJJConflict  = "vcs_jj_conflict"
+	_partVcsJJDescribed = "vcs_jj_described"
+
 	_partVcsSaplRev             = "vcs_sapling_rev"
 	_partVcsSaplNode            = "vcs_sapling_node"
 	_partVcsSaplBookmarks       = "vcs_sapling_bookmarks"
 	_partVcsSaplBookmarkActive  = "vcs_sapling_bookmarks_active"
 	_partVcsSaplBookmarksRemote = "vcs_sapling_bookmarks_remote"
+
+	_partVcsSaplStackPos = "vcs_sapling_stack_pos"
+	_partVcsSaplStackLen = "vcs_sapling_stack_len"
+	_partVcsSaplObsolete = "vcs_sapling_obsolete"
+	_partVcsSaplOrphans  = "vcs_sapling_orphans"
+
+	_partVcsSaplModified = "vcs_sapling_modified"
+	_partVcsSaplAdded    = "vcs_sapling_added"
+	_partVcsSaplRemoved  = "vcs_sapling_removed"
+	_partVcsSaplUnknown  = "vcs_sapling_unknown"
+
+	_partPyEnv        = "py_env"
+	_partPyEnvKind    = "py_env_kind"
+	_partPyEnvVersion = "py_env_version"
+
+	_partK8sContext   = "k8s_context"
+	_partK8sNamespace = "k8s_namespace"
+
+	_partAWSProfile = "aws_profile"
+	_partAWSRegion  = "aws_region"
+
+	_partGCPConfig  = "gcp_config"
+	_partGCPProject = "gcp_project"
+	_partGCPAccount = "gcp_account"
+
+	_partAzureSubscription   = "azure_subscription"
+	_partAzureSubscriptionID = "azure_subscription_id"
+	_partAzureUser           = "azure_user"
+
+	_partEnvContainer     = "env_container"
+	_partEnvContainerName = "env_container_name"
+
+	_partMuxKind    = "mux_kind"
+	_partMuxSession = "mux_session"
+	_partMuxWindow  = "mux_window"
+
+	_partRemoteTransport = "remote_transport"
+	_partRemoteClient    = "remote_client"
+
+	_partUserName         = "user_name"
+	_partUserIsRoot       = "user_is_root"
+	_partUserElevatedFrom = "user_elevated_from"
+
+	_partShellDepth = "shell_depth"
+
+	// Language toolchains are reported as lang_<name> (e.g. "lang_go") from
+	// project files and lang_<name>_exec from running the toolchain.
+	_partLangPrefix     = "lang_"
+	_partLangExecSuffix = "_exec"
 )
 
 func handleQUIT() context.CancelFunc {
@@ -141,373 +247,168 @@ func handleQUIT() context.CancelFunc {
 	return bgctxCancel
 }
 
-func cmdQueryRun(_ *cobra.Command, _ []string) error {
-	debugLog("query: start")
-	defer bgctxCancel()
-
-	printerStop, printPart := startPrinter()
-	defer printerStop()
-
-	if *flgQTimeout != 0 {
-		go func() {
-			// Timeout handler
-			select {
-			case <-bgctx.Done():
-				return
-			case <-time.After(*flgQTimeout):
-				printPart("done", "timeout")
-				printerStop()
-				bgctxCancel()
-				os.Exit(1)
-			}
-		}()
-	}
+// queryEnv describes the shell session a query runs for. For a local query it
+// mirrors the current process, `goprompt serve` receives it from the client.
+type queryEnv struct {
+	Pid int               `json:"pid"`
+	Wd  string            `json:"wd"`
+	Env map[string]string `json:"env"`
+
+	CmdStatus     string        `json:"cmd_status"`
+	PreexecTS     string        `json:"preexec_ts"`
+	PidParentSkip int           `json:"pid_parent_skip"`
+	PidChain      bool          `json:"pid_chain"`
+	Timeout       time.Duration `json:"timeout"`
+
+	Enable  []string `json:"enable"`
+	Disable []string `json:"disable"`
+
+	// psChain memoizes processChain for the providers of the query.
+	psOnce  sync.Once
+	psChain []psEntry
+	psErr   error
+}
 
-	tasks := mkWgPool()
-	defer func() {
-		tasks.Wait()
-		printPart("done", "ok")
-	}()
+func newLocalQueryEnv(cmd *cobra.Command) *queryEnv {
+	q := &queryEnv{
+		Pid: os.Getpid(),
+		Env: make(map[string]string),
 
-	nowTS := time.Now()
-	printPart(_partTimestamp, timeFMT(nowTS))
+		CmdStatus:     *flgQCmdStatus,
+		PreexecTS:     *flgQPreexecTS,
+		PidParentSkip: *flgQPidParentSkip,
+		PidChain:      *flgQPidChain,
+		Timeout:       *flgQTimeout,
 
-	prevCMDStatus := trim(*flgQCmdStatus)
-	if prevCMDStatus != "0" {
-		printPart(_partStatus, fmt.Sprintf("%s", prevCMDStatus))
+		Enable:  cfg.Query.Enable,
+		Disable: cfg.Query.Disable,
 	}
 
-	osName := runtime.GOOS
-	printPart(_partOS, osName)
-
-	tasks.Go(func(ctx context.Context) error {
-		homeDir := os.Getenv("HOME")
-
-		if wd, err := os.Getwd(); err == nil {
-			wdh := strings.Replace(wd, homeDir, "~", 1)
-
-			printPart(_partWorkDir, wdh)
-			printPart(_partWorkDirShort, trimPath(wdh))
-		}
-
-		sessionUser, err := user.Current()
-		if err == nil {
-			printPart(_partSessionUsername, sessionUser.Username)
-		}
-
-		sessionHostname, err := os.Hostname()
-		if err == nil {
-			printPart(_partSessionHostname, sessionHostname)
-		}
-
-		preexecTS := trim(*flgQPreexecTS)
-		if preexecTS != "0" {
-			if ts, err := strconv.Atoi(preexecTS); err == nil {
-				cmdTS := time.Unix(int64(ts), 0)
-				diff := nowTS.Sub(cmdTS).Round(time.Second)
-				if diff > 1 {
-					printPart(_partDuration, diff)
-				}
-			}
-		}
-
-		return nil
-	})
-
-	tasks.Go(func(ctx context.Context) error {
-		type list []interface{}
-		type dict map[string]interface{}
-
-		psRef, err := process.NewProcess(int32(os.Getpid()))
-		if err != nil {
-			printPart("debug_ps_error", err.Error())
-		}
-
-		// Construct chain of processes
-		psChain := make([]*process.Process, 0)
-		for psRef != nil && psRef.Pid != 0 {
-			psParent, err := psRef.ParentWithContext(ctx)
-			if err != nil {
-				printPart("debug_ps_error", err.Error())
-				break
-			}
-
-			psChain = append(psChain, psParent)
-			psRef = psParent
+	q.Wd, _ = os.Getwd()
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			q.Env[k] = v
 		}
+	}
 
-		printPart(_partPidChainLength, len(psChain))
+	if cmd.Flags().Changed("enable") {
+		q.Enable = *flgQEnable
+	}
+	if cmd.Flags().Changed("disable") {
+		q.Disable = *flgQDisable
+	}
 
-		var pidRemote *process.Process
-		var pidChain list
-		for psIdx, ps := range psChain {
-			name, err := ps.Name()
-			if err != nil {
-				continue
-			}
-			cmdline, err := ps.CmdlineSlice()
-			if err != nil {
-				continue
-			}
+	return q
+}
 
-			// Find if we are in a remote session.
-			if strings.Contains(name, "ssh") && pidRemote == nil {
-				pidRemote = ps
-			}
+func (q *queryEnv) getenv(key string) string {
+	return q.Env[key]
+}
 
-			psIdxAdj := psIdx - *flgQPidParentSkip
+func cmdQueryRun(cmd *cobra.Command, _ []string) error {
+	debugLog("query: start")
+	defer bgctxCancel()
 
-			pidExec := ""
-			if len(cmdline) > 0 {
-				pidExec = filepath.Base(cmdline[0])
-			}
-			pidApp := pidExec
-
-			if osName == "darwin" {
-				// Extract $SOME_LOCATION/$NAME.app/.../$EXEC_NAME from cmdline
-				parts := strings.Split(cmdline[0], "/")
-				for i := range parts[:len(parts)-1] {
-					if strings.HasSuffix(parts[i], ".app") {
-						pidApp = parts[i]
-						pidExec = parts[len(parts)-1]
-						break
-					}
-				}
-			}
+	q := newLocalQueryEnv(cmd)
 
-			pidChain = append(pidChain, dict{
-				"name":    name,
-				"pid":     ps.Pid,
-				"cmdline": cmdline,
-				"exec":    pidExec,
-				"app":     pidApp,
-			})
-
-			if psIdxAdj == 1 {
-				printPart(_partPidShell, ps.Pid)
-				printPart(_partPidShellExec, pidExec)
-				printPart(_partPidShellApp, pidApp)
-				printPart(_partPidShellArgs, name)
-			} else if psIdxAdj == 2 {
-				printPart(_partPidParent, ps.Pid)
-				printPart(_partPidParentExec, pidExec)
-				printPart(_partPidParentApp, pidApp)
-				printPart(_partPidParentArgs, name)
-			}
-		}
+	queryProviders, err := selectProviders(q.Enable, q.Disable)
+	if err != nil {
+		return err
+	}
 
-		if pidRemote != nil {
-			name, err := pidRemote.Name()
-			if err == nil {
-				pidShellRemoteExecName, _, _ := strings.Cut(name, " ")
-				printPart(_partPidRemote, pidRemote.Pid)
-				printPart(_partPidRemoteExec, pidShellRemoteExecName)
-			}
+	if *flgQServer {
+		conn, err := dialServer()
+		if err == nil {
+			defer conn.Close()
+			return queryServer(conn, q, os.Stdout)
 		}
+		debugLog("query: server unavailable, running locally: " + err.Error())
+	}
 
-		if *flgQPidChain {
-			pidChainJson, _ := json.Marshal(pidChain)
-			printPart(_partPidChain, string(pidChainJson))
-		}
+	runQuery(bgctx, q, queryProviders, os.Stdout)
+	return nil
+}
 
-		return nil
+// statusList parses the --cmd-status value into the status of each command of
+// the pipeline, as given by $pipestatus in zsh and fish.
+func statusList(s string) ([]int, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '|' || r == '\t' || r == '\n'
 	})
+	if len(fields) == 0 {
+		return []int{0}, nil
+	}
 
-	tasks.Go(func(context.Context) error {
-		subTasks := mkWgPool()
-		defer subTasks.Wait()
-
-		saplingTemplate := `{rev}\t{node}\t{join(remotenames, "#")}\t{join(bookmarks, "#")}\t{activebookmark}\t{ifcontains(rev, revset("."), "@")}\n`
-
-		if _, err := stringExec("sl", "root"); err == nil {
-			printPart(_partVcs, "sapling")
-		} else {
-			return nil
+	list := make([]int, len(fields))
+	for i, field := range fields {
+		st, err := strconv.Atoi(field)
+		if err != nil || st < 0 {
+			return nil, fmt.Errorf("invalid status %q", field)
 		}
+		list[i] = st
+	}
+	return list, nil
+}
 
-		subTasks.Go(func(ctx context.Context) error {
-			if revInfo, err := stringExec("sl", "log", "-r", ".", "--template", saplingTemplate); err == nil {
-				info := strings.Split(revInfo, "\t")
-				printPart(_partVcsSaplRev, info[0])
-				printPart(_partVcsSaplNode, info[1])
-				printPart(_partVcsSaplBookmarks, info[3])
-				if info[4] == "" {
-					printPart(_partVcsSaplBookmarkActive, "@")
-				} else {
-					printPart(_partVcsSaplBookmarkActive, info[4])
-				}
-				printPart(_partVcsSaplBookmarksRemote, info[2])
-			}
-
-			return nil
-		})
-
-		subTasks.Go(func(ctx context.Context) error {
-			if saplStatus, err := stringExec("sl", "status"); err == nil {
-				if len(saplStatus) == 0 {
-					printPart(_partVcsDirty, 0)
-					return nil
-				}
-
-				printPart(_partVcsDirty, 1)
-			}
-			return nil
-		})
+// runQuery runs all given providers for the session described by q and
+// streams the results to w in the KV protocol.
+func runQuery(ctx context.Context, q *queryEnv, queryProviders []Provider, w io.Writer) {
+	printerStop, printPart := startPrinter(w)
+	defer printerStop()
 
-		return nil
-	})
+	printPart(_partPid, q.Pid)
 
-	tasks.Go(func(context.Context) error {
-		subTasks := mkWgPool()
-		defer subTasks.Wait()
+	queryCtx, queryCtxCancel := context.WithCancel(ctx)
+	if q.Timeout != 0 {
+		queryCtx, queryCtxCancel = context.WithTimeout(ctx, q.Timeout)
+	}
+	defer queryCtxCancel()
 
-		if _, err := stringExec("git", "rev-parse", "--show-toplevel"); err == nil {
-			printPart(_partVcs, "git")
+	tasks := mkWgPool(queryCtx)
+	defer func() {
+		tasks.Wait()
+		if queryCtx.Err() != nil {
+			printPart("done", "timeout")
 		} else {
-			return nil
-
+			printPart("done", "ok")
 		}
+	}()
 
-		gitDir, _ := stringExec("git", "rev-parse", "--path-format=absolute", "--git-dir")
-
-		subTasks.Go(func(ctx context.Context) error {
-			headRef := ""
-			if cherryHeadB, _ := os.ReadFile(filepath.Join(gitDir, "CHERRY_PICK_HEAD")); len(cherryHeadB) > 0 {
-				headRef = trim(string(cherryHeadB))
-				printPart(_partVcsGitRebaseOp, "cherry")
-			} else if mergeHeadB, _ := os.ReadFile(filepath.Join(gitDir, "MERGE_HEAD")); len(mergeHeadB) > 0 {
-				headRef = trim(string(mergeHeadB))
-				printPart(_partVcsGitRebaseOp, "merge")
-			} else if rebaseHeadB, _ := os.ReadFile(filepath.Join(gitDir, "rebase-merge", "orig-head")); len(rebaseHeadB) > 0 {
-				headRef = trim(string(rebaseHeadB))
-				printPart(_partVcsGitRebaseOp, "rebase")
-
-				actionsLeftB, _ := os.ReadFile(filepath.Join(gitDir, "rebase-merge", "git-rebase-todo"))
-				actionsLeft := trim(string(actionsLeftB))
-				if len(actionsLeftB) == 0 {
-					printPart(_partVcsGitRebaseLeft, 1)
-				} else {
-					printPart(_partVcsGitRebaseLeft, len(strings.Split(string(actionsLeft), "\n"))+1)
-				}
-			}
-
-			branch := ""
-
-			if len(headRef) != 0 {
-				branch, _ = stringExec("git", "name-rev", "--name-only", headRef)
-			} else {
-				branch, _ = stringExec("git", "branch", "--show-current")
-			}
-			printPart(_partVcsBranch, branch)
-
-			return nil
-		})
-
-		subTasks.Go(func(context.Context) error {
-			status, err := stringExec("git", "status", "--porcelain")
-			if err != nil {
-				return nil
-			}
-
-			if len(status) == 0 {
-				printPart(_partVcsDirty, 0)
-				return nil
-			}
-
-			printPart(_partVcsDirty, 1)
-
-			fTotal := 0
-			fInIndex := 0
-			fOutOfIndex := 0
-
-			lines := strings.Split(status, "\n")
-			for _, line := range lines {
-				if len(line) < 2 {
-					continue
-				}
-
-				statusInIndex := line[0]
-				statusOutOfIndex := line[1]
-
-				if statusInIndex != ' ' {
-					fInIndex += 1
-				}
-				if statusOutOfIndex != ' ' {
-					fOutOfIndex += 1
-				}
-
-				fTotal += 1
-			}
-
-			printPart(_partVcsGitIdxTotal, fTotal)
-			printPart(_partVcsGitIdxIncluded, fInIndex)
-			printPart(_partVcsGitIdxExcluded, fOutOfIndex)
-
-			return nil
-		})
-
-		subTasks.Go(func(context.Context) error {
-			if status, err := stringExec("git", "rev-list", "--left-right", "--count", "HEAD...@{u}"); err == nil {
-				parts := strings.SplitN(status, "\t", 2)
-				if len(parts) < 2 {
-					parts = []string{"0", "0"}
-				}
+	nowTS := time.Now()
+	printPart(_partTimestamp, timeFMT(nowTS))
 
-				printPart(_partVcsLogAhead, parts[0])
-				printPart(_partVcsLogBehind, parts[1])
+	// The status of the pipeline is that of its last command.
+	if pipeStatus, err := statusList(q.CmdStatus); err != nil {
+		debugLog("query: cmd-status: " + err.Error())
+	} else {
+		if st := pipeStatus[len(pipeStatus)-1]; st != 0 {
+			printPart(_partStatus, st)
+			if sig := statusSignal(st); sig != "" {
+				printPart(_partStatusSig, sig)
 			}
-			return nil
-		})
-
-		return nil
-	})
-
-	tasks.Go(func(context.Context) error {
-		var err error
-
-		subTasks := mkWgPool()
-
-		var stgSeriesLen string
-		if stgSeriesLen, err = stringExec("stg", "series", "-c"); err == nil {
-			printPart(_partVcsStg, "1")
-			printPart(_partVcsStgQlen, stgSeriesLen)
-		} else {
-			return nil
 		}
-
-		subTasks.Go(func(context.Context) error {
-			if stgSeriesPos, err := stringExec("stg", "series", "-cA"); err == nil {
-				printPart(_partVcsStgQpos, stgSeriesPos)
+		if len(pipeStatus) > 1 {
+			pipe := make([]string, len(pipeStatus))
+			for i, st := range pipeStatus {
+				pipe[i] = strconv.Itoa(st)
+				printPart(fmt.Sprintf("%s_%d", _partStatusPipe, i), st)
 			}
-			return nil
-		})
-
-		var stgPatchTop string
-		if stgPatchTop, err = stringExec("stg", "top"); err == nil {
-			printPart(_partVcsStgTop, stgPatchTop)
-		} else {
-			return nil
+			printPart(_partStatusPipe, strings.Join(pipe, " "))
 		}
+	}
 
-		subTasks.Go(func(context.Context) error {
-			gitSHA, _ := stringExec("stg", "id")
-			stgSHA, _ := stringExec("stg", "id", stgPatchTop)
+	printPart(_partOS, runtime.GOOS)
 
-			if gitSHA != stgSHA {
-				printPart(_partVcsStgDirty, 1)
-			} else {
-				printPart(_partVcsStgDirty, 0)
-			}
+	for _, p := range queryProviders {
+		p := p
+		tasks.Go(func(ctx context.Context) error {
+			runProvider(ctx, q, p, cfg.Query.Timeouts[p.Name()], printPart)
 			return nil
 		})
-
-		return nil
-	})
-
-	return nil
+	}
 }
 
-func startPrinter() (func(), func(name string, value interface{})) {
+func startPrinter(w io.Writer) (func(), partPrinter) {
 	debugLog("query-printer: start")
 	defer debugLog("query-printer: stop")
 
@@ -515,7 +416,7 @@ func startPrinter() (func(), func(name string, value interface{})) {
 	doneSIG := make(chan struct{})
 	go func() {
 		defer close(doneSIG)
-		shellKVStaggeredPrinter(printCH, 20*time.Millisecond, 100*time.Millisecond)
+		shellKVStaggeredPrinter(w, printCH, cfg.Query.PrinterFirstDelay, cfg.Query.PrinterDelay)
 	}()
 
 	printerStop := func() {
@@ -526,7 +427,6 @@ func startPrinter() (func(), func(name string, value interface{})) {
 		printCH <- shellKV{name, value}
 	}
 
-	printPart(_partPid, os.Getpid())
 	return printerStop, printPart
 }
 
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatusList(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		expected []int
+	}{
+		{"", []int{0}},
+		{"0", []int{0}},
+		{"130", []int{130}},
+		{"255", []int{255}},
+		{"0 141 1", []int{0, 141, 1}},
+		{"0|141|1", []int{0, 141, 1}},
+		{" 0, 141,1\n", []int{0, 141, 1}},
+		{"abc|0", nil},
+		{"0 -1", nil},
+	} {
+		list, err := statusList(tc.in)
+		if tc.expected == nil {
+			if err == nil {
+				t.Errorf("statusList(%q) = %v, expected an error", tc.in, list)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(list, tc.expected) {
+			t.Errorf("statusList(%q) = %v, %v, expected %v", tc.in, list, err, tc.expected)
+		}
+	}
+}
+
+func TestRunQueryStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status   string
+		expected map[string]string
+	}{
+		{"0", map[string]string{}},
+		{"1", map[string]string{"st": "1"}},
+		{"130", map[string]string{"st": "130", "st_signal": "SIGINT"}},
+		{"0 141 0", map[string]string{
+			"st_pipe": "0 141 0", "st_pipe_0": "0", "st_pipe_1": "141", "st_pipe_2": "0",
+		}},
+		{"0 143", map[string]string{
+			"st": "143", "st_signal": "SIGTERM",
+			"st_pipe": "0 143", "st_pipe_0": "0", "st_pipe_1": "143",
+		}},
+		{"x", map[string]string{}},
+	} {
+		var out bytes.Buffer
+		runQuery(context.Background(), &queryEnv{CmdStatus: tc.status}, nil, &out)
+
+		parts := make(map[string]string)
+		for _, line := range strings.Split(out.String(), "\n") {
+			if name, value, ok := strings.Cut(line, "\t"); ok && strings.HasPrefix(name, "st") {
+				parts[name] = value
+			}
+		}
+		if !reflect.DeepEqual(parts, tc.expected) {
+			t.Errorf("runQuery(--cmd-status %q) printed %v, expected %v", tc.status, parts, tc.expected)
+		}
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -51,35 +54,97 @@ var (
 	newline  = "\n"
 )
 
-func setColorMode(mode string) {
+func setColorMode(mode string, colors map[string]string) {
 	wrapC := func(pref, suff string) func(args ...interface{}) string {
 		return func(args ...interface{}) string {
 			return pref + fmt.Sprint(args...) + suff
 		}
 	}
 
+	var mkC func(spec string) func(args ...interface{}) string
 	if mode == "zsh" {
-		redC = wrapC("%F{red}", "%F{reset}")
-		greenC = wrapC("%F{green}", "%F{reset}")
-		yellowC = wrapC("%F{yellow}", "%F{reset}")
-		blueC = wrapC("%F{blue}", "%F{reset}")
-		magentaC = wrapC("%F{magenta}", "%F{reset}")
-		greyC = wrapC("%F{black}", "%F{reset}")
+		mkC = func(spec string) func(args ...interface{}) string {
+			return wrapC("%F{"+spec+"}", "%F{reset}")
+		}
 		newline = "\n%{\r%}"
 
 	} else if mode == "ascii" {
-		redC = color.Red.Render
-		greenC = color.Green.Render
-		yellowC = color.Yellow.Render
-		blueC = color.Blue.Render
-		magentaC = color.Magenta.Render
-		greyC = color.Black.Render
+		mkC = asciiColor
 		newline = "\n"
+
+	} else {
+		return
 	}
+
+	redC = mkC(colors["red"])
+	greenC = mkC(colors["green"])
+	yellowC = mkC(colors["yellow"])
+	blueC = mkC(colors["blue"])
+	magentaC = mkC(colors["magenta"])
+	greyC = mkC(colors["grey"])
+}
+
+// asciiColor resolves a color spec (name, 256 color number or #hex) to an
+// ANSI escape renderer.
+func asciiColor(spec string) func(args ...interface{}) string {
+	if c, ok := color.FgColors[spec]; ok {
+		return c.Render
+	}
+	if c, ok := color.ExFgColors[spec]; ok {
+		return c.Render
+	}
+	if strings.HasPrefix(spec, "#") {
+		return color.HEX(spec).Sprint
+	}
+	if n, err := strconv.ParseUint(spec, 10, 8); err == nil {
+		return color.C256(uint8(n)).Sprint
+	}
+	return fmt.Sprint
+}
+
+// renderSegments maps segment names (as used in the render.top and
+// render.bottom config lists) to functions rendering them. A segment that has
+// nothing to show returns an empty string.
+var renderSegments = map[string]func(p map[string]string) string{
+	"git":       renderGit,
+	"sapling":   renderSapling,
+	"hg":        renderHg,
+	"jj":        renderJJ,
+	"stg":       renderStg,
+	"lang":      renderLang,
+	"status":    renderStatus,
+	"container": renderContainer,
+	"identity":  renderIdentity,
+	"depth":     renderDepth,
+	"parent":    renderParent,
+	"wd":        renderWorkDir,
+	"venv":      renderVenv,
+	"k8s":       renderK8s,
+	"aws":       renderAWS,
+	"gcp":       renderGCP,
+	"azure":     renderAzure,
+	"duration":  renderDuration,
+	"timestamp": renderTimestamp,
+	"remote":    renderRemote,
+}
+
+func renderSegmentList(p map[string]string, names []string) []string {
+	var parts []string
+	for _, name := range names {
+		segmentFN, ok := renderSegments[name]
+		if !ok {
+			debugLog("render: unknown segment " + name)
+			continue
+		}
+		if part := segmentFN(p); len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+	return parts
 }
 
 func cmdRenderRun(_ *cobra.Command, _ []string) error {
-	setColorMode(*flgREscapeMode)
+	setColorMode(*flgREscapeMode, cfg.Render.Colors)
 
 	if _, err := os.Stdin.Stat(); err != nil {
 		fmt.Printf("%#v", err)
@@ -99,180 +164,614 @@ func cmdRenderRun(_ *cobra.Command, _ []string) error {
 		}
 	}
 
-	var partsTop []string
-	if p[_partVcs] == "git" {
-		var gitParts []string
+	partsTop := renderSegmentList(p, cfg.Render.Top)
+	partsBottom := renderSegmentList(p, cfg.Render.Bottom)
+
+	promptMarker := magentaC(">")
+	if *flgRMode == "edit" {
+		promptMarker = redC("<")
+	}
+
+	promptStatusMarker := ":? "
+	if status, ok := p["done"]; ok {
+		if status == "ok" {
+			promptStatusMarker = ":: "
+		} else if status == "timeout" {
+			promptStatusMarker = "xx "
+		}
+	}
+
+	promptLines := []string{""}
+	if len(partsTop) > 0 {
+		promptLines = append(promptLines, promptStatusMarker+strings.Join(partsTop, " "))
+	} else {
+		promptLines = append(promptLines, promptStatusMarker+strings.Repeat("-", 30))
+	}
+	if len(partsBottom) > 0 {
+		promptLines = append(promptLines, promptStatusMarker+strings.Join(partsBottom, " "))
+	}
+	promptLines = append(promptLines, promptMarker)
 
-		gitMark := "git"
-		gitMarkC := yellowC
+	// Add prompt mark to last line
+	lastLine := len(promptLines) - 1
+	if lastLine >= 0 {
+		promptLines[lastLine] = fmt.Sprintf("%v%v", *flgRPromptStartMark, promptLines[lastLine])
+	}
+
+	fullPrompt := strings.Join(promptLines, newline)
+	fmt.Print(fullPrompt)
+
+	return nil
+}
 
-		gitBranch := fmt.Sprint(p[_partVcsBranch])
-		gitBranchC := greenC
+// providerTimedOut reports if the named provider was cut off by its timeout,
+// in which case the segment is likely incomplete.
+func providerTimedOut(p map[string]string, name string) bool {
+	return p[name+_partProviderStateSuffix] == "timeout"
+}
 
-		gitDirtyMarks := ""
-		gitDirtyMarksC := redC
-		if p[_partVcsDirty] != "" && p[_partVcsDirty] != "0" {
-			gitDirtyMarks = "&"
+func renderGit(p map[string]string) string {
+	if p[_partVcs] != "git" {
+		return ""
+	}
 
+	var gitParts []string
+
+	gitMark := "git"
+	gitMarkC := yellowC
+
+	gitBranch := fmt.Sprint(p[_partVcsBranch])
+	gitBranchC := greenC
+	if gitBranch == "" && p[_partVcsGitDetached] != "" {
+		// No branch checked out, show the tag or commit instead.
+		gitBranchC = yellowC
+		if p[_partVcsGitTag] != "" {
+			gitBranch = p[_partVcsGitTag]
+		} else if p[_partVcsGitSha] != "" {
+			gitBranch = "@" + p[_partVcsGitSha]
+		}
+	}
+
+	// Dirty marks: +staged *unstaged ?untracked !conflicted $stash
+	var gitDirtyMarks []string
+	if p[_partVcsDirty] != "" && p[_partVcsDirty] != "0" {
+		if p[_partVcsGitIdxStaged] == "" {
+			// Query without the detailed counts.
+			gitDirtyMarksC := redC
 			if p[_partVcsGitIdxExcluded] == "0" {
 				gitDirtyMarksC = greenC
 			}
+			gitDirtyMarks = append(gitDirtyMarks, gitDirtyMarksC("&"))
 		}
 
-		distanceMarks := ""
-		distanceMarksC := magentaC
+		if n := strInt(p[_partVcsGitIdxStaged]); n > 0 {
+			gitDirtyMarks = append(gitDirtyMarks, greenC(fmt.Sprintf("+%d", n)))
+		}
+		if n := strInt(p[_partVcsGitIdxUnstaged]); n > 0 {
+			gitDirtyMarks = append(gitDirtyMarks, redC(fmt.Sprintf("*%d", n)))
+		}
+		if n := strInt(p[_partVcsGitIdxUntracked]); n > 0 {
+			gitDirtyMarks = append(gitDirtyMarks, yellowC(fmt.Sprintf("?%d", n)))
+		}
+		if n := strInt(p[_partVcsGitIdxConflicted]); n > 0 {
+			gitDirtyMarks = append(gitDirtyMarks, redC(fmt.Sprintf("!%d", n)))
+		}
+	}
+	if n := strInt(p[_partVcsGitStash]); n > 0 {
+		gitDirtyMarks = append(gitDirtyMarks, blueC(fmt.Sprintf("$%d", n)))
+	}
 
-		distanceAhead := strInt(p[_partVcsLogAhead])
-		distanceBehind := strInt(p[_partVcsLogBehind])
-		if distanceAhead > 0 || distanceBehind > 0 {
-			distanceMarks = fmt.Sprintf("[+%v:-%v]", distanceAhead, distanceBehind)
+	distanceMarks := renderDistance(p)
+	distanceMarksC := magentaC
+
+	rebaseOp := ""
+	rebaseOpC := redC
+	if len(p[_partVcsGitRebaseOp]) != 0 {
+		rebaseOp = p[_partVcsGitRebaseOp]
+		if p[_partVcsGitRebaseTotal] != "" {
+			rebaseOp += fmt.Sprintf("(%v/%v)", p[_partVcsGitRebaseStep], p[_partVcsGitRebaseTotal])
+		} else if p[_partVcsGitRebaseLeft] != "" {
+			rebaseOp += fmt.Sprintf("(%v)", p[_partVcsGitRebaseLeft])
 		}
+	}
 
-		rebaseOp := ""
-		rebaseOpC := redC
-		if len(p[_partVcsGitRebaseOp]) != 0 {
-			rebaseOp = p[_partVcsGitRebaseOp]
-			if p[_partVcsGitRebaseLeft] != "" {
-				rebaseOp += fmt.Sprintf("(%v)", p[_partVcsGitRebaseLeft])
-			}
+	// Layout marks: linked worktree, submodule, bare or inside the git dir.
+	var layoutMarks []string
+	if p[_partVcsGitWorktree] != "" {
+		layoutMarks = append(layoutMarks, blueC("wt="+p[_partVcsGitWorktree]))
+	}
+	if p[_partVcsGitSubmodule] != "" {
+		layoutMarks = append(layoutMarks, blueC("sub="+filepath.Base(p[_partVcsGitSubmodule])))
+	}
+	if p[_partVcsGitBare] != "" {
+		layoutMarks = append(layoutMarks, redC("BARE"))
+	} else if p[_partVcsGitInGitDir] != "" {
+		layoutMarks = append(layoutMarks, redC("GIT_DIR"))
+	}
+
+	gitParts = append(gitParts, gitMarkC(gitMark))
+	gitParts = append(gitParts, layoutMarks...)
+	gitParts = append(gitParts, gitBranchC(gitBranch))
+	if len(gitDirtyMarks) > 0 {
+		gitParts = append(gitParts, strings.Join(gitDirtyMarks, ""))
+	}
+	if len(distanceMarks) > 0 {
+		gitParts = append(gitParts, distanceMarksC(distanceMarks))
+	}
+	if len(rebaseOp) > 0 {
+		gitParts = append(gitParts, rebaseOpC(rebaseOp))
+	}
+	if providerTimedOut(p, "git") {
+		gitParts = append(gitParts, redC("xx"))
+	}
+
+	return fmt.Sprintf("{%v}", strings.Join(gitParts, ":"))
+}
+
+// renderDistance renders the distance from upstream ([+ahead:-behind]), or
+// "" when in sync.
+func renderDistance(p map[string]string) string {
+	distanceAhead := strInt(p[_partVcsLogAhead])
+	distanceBehind := strInt(p[_partVcsLogBehind])
+	if distanceAhead > 0 || distanceBehind > 0 {
+		return fmt.Sprintf("[+%v:-%v]", distanceAhead, distanceBehind)
+	}
+	return ""
+}
+
+func renderSapling(p map[string]string) string {
+	if p[_partVcs] != "sapling" {
+		return ""
+	}
+
+	var saplParts []string
+
+	saplMark := "spl"
+	saplMarkC := yellowC
+
+	saplBookmark := fmt.Sprint(p[_partVcsSaplBookmarkActive])
+	saplBookmarkC := greenC
+
+	// Dirty marks: *modified +added -removed ?unknown
+	var saplDirtyMarks []string
+	if p[_partVcsDirty] != "" && p[_partVcsDirty] != "0" {
+		if p[_partVcsSaplModified] == "" {
+			// Query without the detailed counts.
+			saplDirtyMarks = append(saplDirtyMarks, redC("&"))
 		}
 
-		gitParts = append(gitParts, gitMarkC(gitMark))
-		gitParts = append(gitParts, gitBranchC(gitBranch))
-		if len(gitDirtyMarks) > 0 {
-			gitParts = append(gitParts, gitDirtyMarksC(gitDirtyMarks))
+		if n := strInt(p[_partVcsSaplModified]); n > 0 {
+			saplDirtyMarks = append(saplDirtyMarks, redC(fmt.Sprintf("*%d", n)))
 		}
-		if len(distanceMarks) > 0 {
-			gitParts = append(gitParts, distanceMarksC(distanceMarks))
+		if n := strInt(p[_partVcsSaplAdded]); n > 0 {
+			saplDirtyMarks = append(saplDirtyMarks, greenC(fmt.Sprintf("+%d", n)))
 		}
-		if len(rebaseOp) > 0 {
-			gitParts = append(gitParts, rebaseOpC(rebaseOp))
+		if n := strInt(p[_partVcsSaplRemoved]); n > 0 {
+			saplDirtyMarks = append(saplDirtyMarks, redC(fmt.Sprintf("-%d", n)))
 		}
+		if n := strInt(p[_partVcsSaplUnknown]); n > 0 {
+			saplDirtyMarks = append(saplDirtyMarks, yellowC(fmt.Sprintf("?%d", n)))
+		}
+	}
+
+	saplStack := ""
+	saplStackC := blueC
+	if p[_partVcsSaplStackLen] != "" {
+		saplStack = fmt.Sprintf("%v/%v", p[_partVcsSaplStackPos], p[_partVcsSaplStackLen])
+	}
+
+	distanceMarks := renderDistance(p)
+	distanceMarksC := magentaC
+
+	saplRestack := ""
+	saplRestackC := redC
+	if p[_partVcsSaplObsolete] == "1" {
+		saplRestack = "obsolete"
+	} else if strInt(p[_partVcsSaplOrphans]) > 0 {
+		saplRestack = "restack"
+	}
+
+	saplParts = append(saplParts, saplMarkC(saplMark))
+	saplParts = append(saplParts, saplBookmarkC(saplBookmark))
+	if len(saplDirtyMarks) > 0 {
+		saplParts = append(saplParts, strings.Join(saplDirtyMarks, ""))
+	}
+	if len(saplStack) > 0 {
+		saplParts = append(saplParts, saplStackC(saplStack))
+	}
+	if len(distanceMarks) > 0 {
+		saplParts = append(saplParts, distanceMarksC(distanceMarks))
+	}
+	if len(saplRestack) > 0 {
+		saplParts = append(saplParts, saplRestackC(saplRestack))
+	}
+	if providerTimedOut(p, "sapling") {
+		saplParts = append(saplParts, redC("xx"))
+	}
+
+	return fmt.Sprintf("{%v}", strings.Join(saplParts, ":"))
+}
 
-		partsTop = append(partsTop, fmt.Sprintf("{%v}", strings.Join(gitParts, ":")))
+func renderHg(p map[string]string) string {
+	if p[_partVcs] != "hg" {
+		return ""
 	}
 
-	if p[_partVcs] == "sapling" {
-		var saplParts []string
+	var hgParts []string
+
+	hgMark := "hg"
+	hgMarkC := yellowC
 
-		saplMark := "spl"
-		saplMarkC := yellowC
+	hgBranch := fmt.Sprint(p[_partVcsBranch])
+	if p[_partVcsHgTopic] != "" {
+		hgBranch += "//" + p[_partVcsHgTopic]
+	}
+	hgBranchC := greenC
 
-		saplBookmark := fmt.Sprint(p[_partVcsSaplBookmarkActive])
-		saplBookmarkC := greenC
+	hgBookmark := ""
+	hgBookmarkC := blueC
+	if p[_partVcsHgBookmark] != "" {
+		hgBookmark = "*" + p[_partVcsHgBookmark]
+	}
 
-		saplDirtyMarks := ""
-		saplDirtyMarksC := redC
-		if p[_partVcsDirty] != "" && p[_partVcsDirty] != "0" {
-			saplDirtyMarks = "&"
+	hgDirtyMarks := ""
+	hgDirtyMarksC := redC
+	if p[_partVcsDirty] != "" && p[_partVcsDirty] != "0" {
+		hgDirtyMarks = "&"
+	}
+
+	// Public is the common case and not worth the space.
+	hgPhase := ""
+	hgPhaseC := greyC
+	if phase := p[_partVcsHgPhase]; phase != "" && phase != "public" {
+		hgPhase = phase
+		if phase == "secret" {
+			hgPhaseC = redC
 		}
+	}
+
+	hgParts = append(hgParts, hgMarkC(hgMark))
+	hgParts = append(hgParts, hgBranchC(hgBranch))
+	if len(hgBookmark) > 0 {
+		hgParts = append(hgParts, hgBookmarkC(hgBookmark))
+	}
+	if len(hgDirtyMarks) > 0 {
+		hgParts = append(hgParts, hgDirtyMarksC(hgDirtyMarks))
+	}
+	if len(hgPhase) > 0 {
+		hgParts = append(hgParts, hgPhaseC(hgPhase))
+	}
+	if providerTimedOut(p, "hg") {
+		hgParts = append(hgParts, redC("xx"))
+	}
+
+	return fmt.Sprintf("{%v}", strings.Join(hgParts, ":"))
+}
 
-		saplParts = append(saplParts, saplMarkC(saplMark))
-		saplParts = append(saplParts, saplBookmarkC(saplBookmark))
-		if len(saplDirtyMarks) > 0 {
-			saplParts = append(saplParts, saplDirtyMarksC(saplDirtyMarks))
+func renderJJ(p map[string]string) string {
+	if p[_partVcs] != "jj" {
+		return ""
+	}
+
+	var jjParts []string
+
+	jjMark := "jj"
+	jjMarkC := yellowC
+
+	jjChange := p[_partVcsJJChange]
+	jjChangeC := magentaC
+
+	jjBookmarks := p[_partVcsJJBookmarks]
+	jjBookmarksC := greenC
+
+	// The working copy commit has changes, and whether they are described
+	// yet.
+	jjDirtyMarks := ""
+	jjDirtyMarksC := redC
+	if p[_partVcsDirty] != "" && p[_partVcsDirty] != "0" {
+		jjDirtyMarks = "&"
+		if p[_partVcsJJDescribed] == "1" {
+			jjDirtyMarksC = greenC
 		}
+	}
 
-		partsTop = append(partsTop, fmt.Sprintf("{%v}", strings.Join(saplParts, ":")))
+	jjParts = append(jjParts, jjMarkC(jjMark))
+	jjParts = append(jjParts, jjChangeC(jjChange))
+	if len(jjBookmarks) > 0 {
+		jjParts = append(jjParts, jjBookmarksC(jjBookmarks))
+	}
+	if len(jjDirtyMarks) > 0 {
+		jjParts = append(jjParts, jjDirtyMarksC(jjDirtyMarks))
 	}
+	if p[_partVcsJJConflict] == "1" {
+		jjParts = append(jjParts, redC("conflict"))
+	}
+	if providerTimedOut(p, "jj") {
+		jjParts = append(jjParts, redC("xx"))
+	}
+
+	return fmt.Sprintf("{%v}", strings.Join(jjParts, ":"))
+}
+
+func renderStg(p map[string]string) string {
+	if p[_partVcsStg] == "" {
+		return ""
+	}
+
+	var stgParts []string
 
-	if p[_partVcsStg] != "" {
-		var stgParts []string
+	stgMark := "stg"
+	stgMarkC := yellowC
 
-		stgMark := "stg"
-		stgMarkC := yellowC
+	stgTopPatch := p[_partVcsStgTop]
+	stgTopPatchC := greenC
+
+	stgQueueMark := ""
+	stgQueueMarkC := normalC
+
+	stgQueueLen := strInt(p[_partVcsStgQlen])
+	stgQueuePos := strInt(p[_partVcsStgQpos])
+	if stgQueueLen > 0 {
+		stgQueueMark = fmt.Sprintf("%d/%d", stgQueuePos, stgQueueLen)
+	}
+
+	stgHiddenMark := ""
+	stgHiddenMarkC := greyC
+	if stgHidden := strInt(p[_partVcsStgHidden]); stgHidden > 0 {
+		stgHiddenMark = fmt.Sprintf("~%d", stgHidden)
+	}
+
+	if strInt(p[_partVcsStgDirty]) != 0 {
+		stgTopPatchC = redC
+	}
+
+	stgParts = append(stgParts, stgMarkC(stgMark))
+
+	if len(stgTopPatch) > 0 {
+		stgParts = append(stgParts, stgTopPatchC(stgTopPatch))
+
+	}
+
+	if len(stgQueueMark) > 0 {
+		stgParts = append(stgParts, stgQueueMarkC(stgQueueMark))
+	}
+	if len(stgHiddenMark) > 0 {
+		stgParts = append(stgParts, stgHiddenMarkC(stgHiddenMark))
+	}
+	if providerTimedOut(p, "stg") {
+		stgParts = append(stgParts, redC("xx"))
+	}
 
-		stgTopPatch := p[_partVcsStgTop]
-		stgTopPatchC := greenC
+	return fmt.Sprintf("{%v}", strings.Join(stgParts, ":"))
+}
 
-		stgQueueMark := ""
-		stgQueueMarkC := normalC
+// renderLang shows the toolchains in use, preferring the versions reported
+// by the toolchains over the ones requested by project files.
+func renderLang(p map[string]string) string {
+	var langParts []string
+	for _, lang := range langToolchains {
+		version, ok := p[_partLangPrefix+lang.name]
+		if !ok {
+			continue
+		}
+		if execVersion := p[_partLangPrefix+lang.name+_partLangExecSuffix]; execVersion != "" {
+			version = execVersion
+		}
 
-		stgQueueLen := strInt(p[_partVcsStgQlen])
-		stgQueuePos := strInt(p[_partVcsStgQpos])
-		if stgQueuePos > 0 {
-			stgQueueMark = fmt.Sprintf("%d/%d", stgQueuePos, stgQueueLen)
+		if version == "" {
+			langParts = append(langParts, lang.name)
+		} else {
+			langParts = append(langParts, lang.name+":"+version)
 		}
+	}
+	timedOut := providerTimedOut(p, "lang")
+	if len(langParts) == 0 && !timedOut {
+		return ""
+	}
 
-		if strInt(p[_partVcsStgDirty]) != 0 {
-			stgTopPatchC = redC
+	lang := blueC(strings.Join(langParts, " "))
+	if timedOut {
+		if len(langParts) > 0 {
+			lang += " "
 		}
+		lang += redC("xx")
+	}
+	return blueC("<") + lang + blueC(">")
+}
 
-		stgParts = append(stgParts, stgMarkC(stgMark))
+func renderContainer(p map[string]string) string {
+	if p[_partEnvContainer] == "" {
+		return ""
+	}
 
-		if len(stgTopPatch) > 0 {
-			stgParts = append(stgParts, stgTopPatchC(stgTopPatch))
+	container := p[_partEnvContainer]
+	if p[_partEnvContainerName] != "" {
+		container += ":" + p[_partEnvContainerName]
+	}
+	return magentaC("[" + container + "]")
+}
 
-		}
+// renderIdentity warns about root shells and shells running as another user
+// than the one logged in.
+func renderIdentity(p map[string]string) string {
+	identity := ""
+	identityC := yellowC
+	if p[_partUserIsRoot] == "1" {
+		identity = "#root"
+		identityC = redC
+	} else if p[_partUserElevatedFrom] != "" {
+		identity = p[_partUserName]
+	} else {
+		return ""
+	}
 
-		if len(stgQueueMark) > 0 {
-			stgParts = append(stgParts, stgQueueMarkC(stgQueueMark))
+	if p[_partUserElevatedFrom] != "" {
+		identity += "(" + p[_partUserElevatedFrom] + ")"
+	}
+	return identityC(identity)
+}
+
+func renderStatus(p map[string]string) string {
+	// The whole pipeline is shown when any of its commands failed, which may
+	// not be the last one.
+	statuses := strings.Fields(p[_partStatusPipe])
+	if len(statuses) == 0 {
+		statuses = []string{p[_partStatus]}
+	}
+
+	failed := false
+	for i, st := range statuses {
+		if strInt(st) > 0 {
+			failed = true
 		}
+		if sig := statusSignal(strInt(st)); sig != "" {
+			statuses[i] = sig
+		}
+	}
+	if !failed {
+		return ""
+	}
+	return redC("[" + strings.Join(statuses, "|") + "]")
+}
 
-		partsTop = append(partsTop, fmt.Sprintf("{%v}", strings.Join(stgParts, ":")))
+// renderDepth renders the nesting depth of the shell, only when nested.
+func renderDepth(p map[string]string) string {
+	if strInt(p[_partShellDepth]) > 1 {
+		return yellowC("^" + p[_partShellDepth])
 	}
+	return ""
+}
 
-	var partsBottom []string
-	if strInt(p[_partStatus]) > 0 {
-		partsBottom = append(partsBottom, redC("["+p[_partStatus]+"]"))
+func renderParent(p map[string]string) string {
+	// The multiplexer says more than its server process.
+	if mux := renderMux(p); mux != "" {
+		return mux
 	}
 
 	if p[_partPidParentExec] != "" && p[_partPidParentApp] != "" {
-		partsBottom = append(partsBottom, fmt.Sprintf("(%v/%v)", p[_partPidParentApp], p[_partPidParentExec]))
+		return fmt.Sprintf("(%v/%v)", p[_partPidParentApp], p[_partPidParentExec])
 	} else if p[_partPidParentExec] != "" {
-		partsBottom = append(partsBottom, fmt.Sprintf("(%v)", p[_partPidParentExec]))
+		return fmt.Sprintf("(%v)", p[_partPidParentExec])
 	}
+	return ""
+}
 
-	partsBottom = append(partsBottom, yellowC("(")+blueC(p[_partWorkDirShort])+yellowC(")"))
+// renderMux renders the multiplexer session, when the shell is running
+// directly in the multiplexer.
+func renderMux(p map[string]string) string {
+	kind := p[_partMuxKind]
+	if kind == "" {
+		return ""
+	}
 
-	if p[_partDuration] != "" {
-		partsBottom = append(partsBottom, fmt.Sprintf("%v", p[_partDuration]))
+	parent := strings.ToLower(p[_partPidParentExec] + " " + p[_partPidParentArgs])
+	if p[_partPidParentExec] != "" && !strings.Contains(parent, kind) {
+		return ""
 	}
 
-	nowTS := time.Now()
-	cmdTS := timeFMT(nowTS)
-	if len(p[_partTimestamp]) != 0 {
-		cmdTS = p[_partTimestamp]
+	mux := kind
+	if p[_partMuxSession] != "" {
+		mux += ":" + p[_partMuxSession]
+		if p[_partMuxWindow] != "" {
+			mux += "/" + p[_partMuxWindow]
+		}
+	}
+	if providerTimedOut(p, "mux") {
+		mux += ":" + redC("xx")
 	}
-	partsBottom = append(partsBottom, fmt.Sprintf("[%v]", cmdTS))
+	return fmt.Sprintf("(%v)", mux)
+}
+
+func renderWorkDir(p map[string]string) string {
+	return yellowC("(") + blueC(p[_partWorkDirShort]) + yellowC(")")
+}
 
-	if len(p[_partPidRemote]) != 0 {
-		partsBottom = append(partsBottom, greyC(fmt.Sprintf("%v@%v", p[_partSessionUsername], p[_partSessionHostname])))
+func renderVenv(p map[string]string) string {
+	if p[_partPyEnv] == "" {
+		return ""
 	}
 
-	promptMarker := magentaC(">")
-	if *flgRMode == "edit" {
-		promptMarker = redC("<")
+	venv := "py:" + p[_partPyEnv]
+	if p[_partPyEnvVersion] != "" {
+		venv += ":" + p[_partPyEnvVersion]
 	}
+	return yellowC("(") + greenC(venv) + yellowC(")")
+}
 
-	promptStatusMarker := ":? "
-	if status, ok := p["done"]; ok {
-		if status == "ok" {
-			promptStatusMarker = ":: "
-		} else if status == "timeout" {
-			promptStatusMarker = "xx "
+func renderK8s(p map[string]string) string {
+	if p[_partK8sContext] == "" {
+		return ""
+	}
+
+	k8s := "k8s:" + p[_partK8sContext]
+	if p[_partK8sNamespace] != "" {
+		k8s += ":" + p[_partK8sNamespace]
+	}
+
+	k8sC := blueC
+	if pattern := cfg.K8s.ProductionPattern; pattern != "" {
+		if re, err := regexp.Compile(pattern); err != nil {
+			debugLog("render: bad k8s.production_pattern: " + err.Error())
+		} else if re.MatchString(p[_partK8sContext]) {
+			k8sC = redC
 		}
 	}
+	return yellowC("(") + k8sC(k8s) + yellowC(")")
+}
 
-	promptLines := []string{""}
-	if len(partsTop) > 0 {
-		promptLines = append(promptLines, promptStatusMarker+strings.Join(partsTop, " "))
-	} else {
-		promptLines = append(promptLines, promptStatusMarker+strings.Repeat("-", 30))
+func renderAWS(p map[string]string) string {
+	if p[_partAWSProfile] == "" && p[_partAWSRegion] == "" {
+		return ""
 	}
-	if len(partsBottom) > 0 {
-		promptLines = append(promptLines, promptStatusMarker+strings.Join(partsBottom, " "))
+
+	aws := p[_partAWSProfile]
+	if aws == "" {
+		aws = "default"
 	}
-	promptLines = append(promptLines, promptMarker)
+	if p[_partAWSRegion] != "" {
+		aws += ":" + p[_partAWSRegion]
+	}
+	return yellowC("(") + magentaC("aws:"+aws) + yellowC(")")
+}
 
-	// Add prompt mark to last line
-	lastLine := len(promptLines) - 1
-	if lastLine >= 0 {
-		promptLines[lastLine] = fmt.Sprintf("%v%v", *flgRPromptStartMark, promptLines[lastLine])
+func renderGCP(p map[string]string) string {
+	if p[_partGCPConfig] == "" {
+		return ""
 	}
 
-	fullPrompt := strings.Join(promptLines, newline)
-	fmt.Print(fullPrompt)
+	gcp := p[_partGCPConfig]
+	if p[_partGCPProject] != "" {
+		gcp += ":" + p[_partGCPProject]
+	}
+	return yellowC("(") + magentaC("gcp:"+gcp) + yellowC(")")
+}
 
-	return nil
+func renderAzure(p map[string]string) string {
+	if p[_partAzureSubscription] == "" {
+		return ""
+	}
+	return yellowC("(") + magentaC("az:"+p[_partAzureSubscription]) + yellowC(")")
+}
+
+func renderDuration(p map[string]string) string {
+	if p[_partDuration] != "" {
+		return fmt.Sprintf("%v", p[_partDuration])
+	}
+	return ""
+}
+
+func renderTimestamp(p map[string]string) string {
+	nowTS := time.Now()
+	cmdTS := timeFMT(nowTS)
+	if len(p[_partTimestamp]) != 0 {
+		cmdTS = p[_partTimestamp]
+	}
+	return fmt.Sprintf("[%v]", cmdTS)
+}
+
+func renderRemote(p map[string]string) string {
+	if len(p[_partRemoteTransport]) != 0 {
+		return greyC(fmt.Sprintf("%v@%v", p[_partSessionUsername], p[_partSessionHostname]))
+	}
+	return ""
 }
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// statusSignal returns "", statuses are not made up from signals outside of
+// unix.
+func statusSignal(int) string {
+	return ""
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderStatus(t *testing.T) {
+	for _, tc := range []struct {
+		parts    map[string]string
+		expected string
+	}{
+		{map[string]string{}, ""},
+		{map[string]string{"st": "1"}, "[1]"},
+		{map[string]string{"st": "130"}, "[SIGINT]"},
+		{map[string]string{"st": "143"}, "[SIGTERM]"},
+		{map[string]string{"st": "139"}, "[SIGSEGV]"},
+		{map[string]string{"st": "255"}, "[255]"},
+		{map[string]string{"st": "1", "st_pipe": "0 141 1"}, "[0|SIGPIPE|1]"},
+		{map[string]string{"st_pipe": "1 0"}, "[1|0]"},
+		{map[string]string{"st_pipe": "0 0"}, ""},
+	} {
+		if s := renderStatus(tc.parts); s != tc.expected {
+			t.Errorf("renderStatus(%v) = %q, expected %q", tc.parts, s, tc.expected)
+		}
+	}
+}
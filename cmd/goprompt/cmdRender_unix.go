@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// statusSignal returns the name of the signal (e.g. SIGINT) that killed the
+// command when the status is above 128, or "" otherwise.
+func statusSignal(status int) string {
+	if status <= 128 {
+		return ""
+	}
+	return unix.SignalName(syscall.Signal(status - 128))
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdServe = &cobra.Command{
+		Use:   "serve",
+		Short: "run a per-user daemon answering `goprompt query --server` over a unix socket",
+	}
+)
+
+func init() {
+	cmdServe.RunE = cmdServeRun
+}
+
+// serveSocketPath returns the unix socket shared by `goprompt serve` and
+// `goprompt query --server`, after checking that no other user can have put
+// it there. The default socket lives in a private directory, which is created
+// by the server when create is set.
+func serveSocketPath(create bool) (string, error) {
+	// A configured socket is up to the user, as long as nobody else can
+	// write to its directory.
+	if cfg.Serve.Socket != "" {
+		return cfg.Serve.Socket, serveCheckDir(filepath.Dir(cfg.Serve.Socket), 0022)
+	}
+
+	socketDir := filepath.Join(os.TempDir(), fmt.Sprintf("goprompt-%d", os.Getuid()))
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		socketDir = filepath.Join(runtimeDir, "goprompt")
+	}
+	if create {
+		if err := os.Mkdir(socketDir, 0700); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+	}
+	return filepath.Join(socketDir, "goprompt.sock"), serveCheckDir(socketDir, 0077)
+}
+
+// serveCheckDir checks that dir is a directory owned by the current user,
+// without any of the forbidden permission bits.
+func serveCheckDir(dir string, forbidden os.FileMode) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%v is not a directory", dir)
+	}
+	if !serveOwned(fi) {
+		return fmt.Errorf("%v is not owned by the current user", dir)
+	}
+	if fi.Mode().Perm()&forbidden != 0 {
+		return fmt.Errorf("%v is accessible by other users (%v)", dir, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// serveCheckPeer checks that the other end of the connection runs as the
+// current user, the environment of the shell is sent over it.
+func serveCheckPeer(conn net.Conn) error {
+	uid, err := servePeerUid(conn)
+	if err != nil {
+		return err
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("peer runs as uid %d", uid)
+	}
+	return nil
+}
+
+func serveListen(socketPath string) (net.Listener, error) {
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+			defer conn.Close()
+			if err := serveCheckPeer(conn); err != nil {
+				return nil, fmt.Errorf("%v is held by another server: %w", socketPath, err)
+			}
+			return nil, fmt.Errorf("goprompt serve is already running on %v", socketPath)
+		}
+		// Stale socket left behind by a previous server.
+		if err := os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return serveListenPrivate(socketPath)
+}
+
+func cmdServeRun(cmd *cobra.Command, _ []string) error {
+	ctx, ctxCancel := signal.NotifyContext(bgctx, os.Interrupt, syscall.SIGTERM)
+	defer ctxCancel()
+
+	socketPath, err := serveSocketPath(true)
+	if err != nil {
+		return err
+	}
+	l, err := serveListen(socketPath)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	var watcher *fsWatcher
+	if cfg.Serve.Watch {
+		watcher = newFSWatcher(cfg.Serve.WatchMaxDirs)
+	}
+	if watcher != nil {
+		defer watcher.Close()
+	}
+
+	debugLog("serve: listening on " + socketPath)
+	cache := newProviderCache(cfg.Serve.CacheTTL, watcher)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := serveCheckPeer(conn); err != nil {
+			debugLog("serve: rejected connection: " + err.Error())
+			conn.Close()
+			continue
+		}
+		go serveConn(ctx, conn, cache)
+	}
+}
+
+func serveConn(ctx context.Context, conn net.Conn, cache *providerCache) {
+	defer conn.Close()
+
+	var q queryEnv
+	if err := json.NewDecoder(conn).Decode(&q); err != nil {
+		debugLog("serve: bad request: " + err.Error())
+		return
+	}
+
+	queryProviders, err := selectProviders(q.Enable, q.Disable)
+	if err != nil {
+		debugLog("serve: bad request: " + err.Error())
+		return
+	}
+	for i, p := range queryProviders {
+		queryProviders[i] = cache.wrap(p)
+	}
+
+	// The client never sends anything after the request, so a finished read
+	// means it went away and the query can be abandoned.
+	ctx, ctxCancel := context.WithCancel(ctx)
+	defer ctxCancel()
+	go func() {
+		io.Copy(io.Discard, conn)
+		ctxCancel()
+	}()
+
+	runQuery(ctx, &q, queryProviders, conn)
+}
+
+// dialServer connects to a running `goprompt serve` of the current user.
+func dialServer() (net.Conn, error) {
+	socketPath, err := serveSocketPath(false)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if err := serveCheckPeer(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// queryServer sends the query to the server and streams its response to w.
+func queryServer(conn net.Conn, q *queryEnv, w io.Writer) error {
+	if err := json.NewEncoder(conn).Encode(q); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, conn)
+	return err
+}
+
+// ----------------------------------------------------------------------------
+
+// cacheableProvider is implemented by providers whose results only depend on
+// a location shared between shells (e.g. the repository root), which allows
+// `goprompt serve` to reuse them across queries.
+type cacheableProvider interface {
+	Provider
+
+	// CacheKey identifies the shared location for the session, an empty
+	// key disables caching.
+	CacheKey(q *queryEnv) string
+}
+
+type providerCache struct {
+	ttl     time.Duration
+	watcher *fsWatcher
+
+	mu      sync.Mutex
+	entries map[string]*providerCacheEntry
+}
+
+type providerCacheEntry struct {
+	readySIG chan struct{}
+
+	ts    time.Time
+	parts []shellKV
+	ok    bool
+
+	watchRoot *fsWatchRoot
+	watchGen  uint64
+}
+
+func newProviderCache(ttl time.Duration, watcher *fsWatcher) *providerCache {
+	return &providerCache{
+		ttl:     ttl,
+		watcher: watcher,
+		entries: make(map[string]*providerCacheEntry),
+	}
+}
+
+func (e *providerCacheEntry) ready() bool {
+	select {
+	case <-e.readySIG:
+		return true
+	default:
+		return false
+	}
+}
+
+// fresh reports if the entry can be served, which is until a change is
+// observed for watched entries and for the ttl otherwise.
+func (c *providerCache) fresh(e *providerCacheEntry, now time.Time) bool {
+	if !e.ok {
+		return false
+	}
+	if changed, watched := c.watcher.changed(e.watchRoot, e.watchGen); watched {
+		return !changed
+	}
+	return now.Sub(e.ts) < c.ttl
+}
+
+// acquire returns the entry for key, and whether the caller is now
+// responsible for filling it in (and must call release).
+func (c *providerCache) acquire(key string) (*providerCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var inherited *fsWatchRoot
+	for k, e := range c.entries {
+		if !e.ready() || c.fresh(e, now) {
+			continue
+		}
+		delete(c.entries, k)
+
+		// The entry replacing a stale one keeps its watch rather than
+		// walking the repository again, unless the watch was given up.
+		if k == key && c.watcher.usable(e.watchRoot) {
+			inherited = e.watchRoot
+		} else {
+			c.watcher.release(e.watchRoot)
+		}
+	}
+
+	if e, ok := c.entries[key]; ok {
+		return e, false
+	}
+
+	e := &providerCacheEntry{readySIG: make(chan struct{}), watchRoot: inherited}
+	c.entries[key] = e
+	return e, true
+}
+
+// release fills in the entry returned by acquire. An entry that is not ok is
+// never served and evicted along with stale ones.
+func (c *providerCache) release(e *providerCacheEntry, parts []shellKV, ok bool, watchRoot *fsWatchRoot, watchGen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.ts = time.Now()
+	e.parts = parts
+	e.ok = ok
+	e.watchRoot = watchRoot
+	e.watchGen = watchGen
+	close(e.readySIG)
+}
+
+func (c *providerCache) wrap(p Provider) Provider {
+	if c.ttl <= 0 {
+		return p
+	}
+	if cp, ok := p.(cacheableProvider); ok {
+		return cachedProvider{cp, c}
+	}
+	return p
+}
+
+// cachedProvider shares the results of a cacheableProvider between queries
+// for the same cache key, including queries that are in flight concurrently.
+type cachedProvider struct {
+	cacheableProvider
+	cache *providerCache
+}
+
+func (p cachedProvider) cacheKey(q *queryEnv) (string, string) {
+	key := p.CacheKey(q)
+	if key == "" {
+		return "", ""
+	}
+	return p.Name() + "\x00" + key, key
+}
+
+func (p cachedProvider) Detect(ctx context.Context, q *queryEnv) bool {
+	if key, _ := p.cacheKey(q); key != "" {
+		p.cache.mu.Lock()
+		e, ok := p.cache.entries[key]
+		p.cache.mu.Unlock()
+
+		if ok && (!e.ready() || p.cache.fresh(e, time.Now())) {
+			return true
+		}
+	}
+	return p.cacheableProvider.Detect(ctx, q)
+}
+
+func (p cachedProvider) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	key, providerKey := p.cacheKey(q)
+	if key == "" {
+		return p.cacheableProvider.Collect(ctx, q, printPart)
+	}
+
+	e, owner := p.cache.acquire(key)
+	if !owner {
+		select {
+		case <-e.readySIG:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if !e.ok {
+			return p.cacheableProvider.Collect(ctx, q, printPart)
+		}
+		for _, part := range e.parts {
+			printPart(part.name, part.value)
+		}
+		return nil
+	}
+
+	// Watch before collecting, so that changes racing with the collection
+	// already count as invalidating the result.
+	watchRoot := e.watchRoot
+	var watchGen uint64
+	if watchRoot != nil {
+		watchGen = p.cache.watcher.generation(watchRoot)
+	} else if wp, ok := p.cacheableProvider.(watchableProvider); ok {
+		watchRoot, watchGen = p.cache.watcher.watch(providerKey, wp.WatchSpec(q, providerKey))
+	}
+
+	var partsMu sync.Mutex
+	var parts []shellKV
+	err := p.cacheableProvider.Collect(ctx, q, func(name string, value interface{}) {
+		partsMu.Lock()
+		parts = append(parts, shellKV{name, value})
+		partsMu.Unlock()
+
+		printPart(name, value)
+	})
+
+	p.cache.release(e, parts, err == nil && ctx.Err() == nil, watchRoot, watchGen)
+	return err
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// serveOwned can not tell the owner of a file on this platform, so that the
+// socket directory is refused rather than trusted.
+func serveOwned(os.FileInfo) bool {
+	return false
+}
+
+func serveListenPrivate(string) (net.Listener, error) {
+	return nil, errors.New("goprompt serve is not supported on this platform")
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// servePeerUid is not implemented on this platform, so that connections are
+// refused rather than trusted.
+func servePeerUid(net.Conn) (int, error) {
+	return 0, errors.New("peer credentials are not supported on this platform")
+}
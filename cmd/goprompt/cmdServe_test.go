@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServeCheckDir(t *testing.T) {
+	root := t.TempDir()
+
+	private := filepath.Join(root, "private")
+	if err := os.Mkdir(private, 0700); err != nil {
+		t.Fatal(err)
+	}
+	shared := filepath.Join(root, "shared")
+	if err := os.Mkdir(shared, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// Mkdir is subject to the umask.
+	if err := os.Chmod(shared, 0777); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(private, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		dir       string
+		forbidden os.FileMode
+		ok        bool
+	}{
+		{private, 0077, true},
+		{shared, 0077, false},
+		{shared, 0022, false},
+		{file, 0077, false},
+		{link, 0077, false},
+		{filepath.Join(root, "missing"), 0077, false},
+	} {
+		if err := serveCheckDir(tc.dir, tc.forbidden); (err == nil) != tc.ok {
+			t.Errorf("serveCheckDir(%v, %o) = %v", filepath.Base(tc.dir), tc.forbidden, err)
+		}
+	}
+}
+
+func TestServePeerUid(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			defer conn.Close()
+			if err := serveCheckPeer(conn); err != nil {
+				t.Errorf("server: serveCheckPeer() = %v", err)
+			}
+		}
+	}()
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	uid, err := servePeerUid(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != os.Getuid() {
+		t.Errorf("servePeerUid() = %v, expected %v", uid, os.Getuid())
+	}
+}
+
+// testCacheProvider is a cacheableProvider counting its collections, which
+// are held back until release is closed (if set).
+type testCacheProvider struct {
+	key     string
+	fail    bool
+	release chan struct{}
+	calls   *int32
+}
+
+func (p testCacheProvider) Name() string {
+	return "cached"
+}
+
+func (p testCacheProvider) Detect(context.Context, *queryEnv) bool {
+	return true
+}
+
+func (p testCacheProvider) CacheKey(*queryEnv) string {
+	return p.key
+}
+
+func (p testCacheProvider) Collect(ctx context.Context, _ *queryEnv, printPart partPrinter) error {
+	n := atomic.AddInt32(p.calls, 1)
+	if p.release != nil {
+		<-p.release
+	}
+	printPart("cached_calls", n)
+	if p.fail {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+// collectCached runs a single collection of p through the cache and returns
+// the printed value of cached_calls.
+func collectCached(t *testing.T, p Provider) interface{} {
+	t.Helper()
+	var tp testParts
+	p.Collect(context.Background(), &queryEnv{}, tp.printPart)
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.parts["cached_calls"]
+}
+
+func TestProviderCacheWrap(t *testing.T) {
+	p := testCacheProvider{key: "repo", calls: new(int32)}
+
+	if _, ok := newProviderCache(0, nil).wrap(p).(cachedProvider); ok {
+		t.Errorf("wrap() cached without a ttl")
+	}
+	if _, ok := newProviderCache(time.Minute, nil).wrap(testProvider{name: "p"}).(cachedProvider); ok {
+		t.Errorf("wrap() cached a provider without a cache key")
+	}
+	if _, ok := newProviderCache(time.Minute, nil).wrap(p).(cachedProvider); !ok {
+		t.Errorf("wrap() did not cache")
+	}
+}
+
+func TestProviderCacheShared(t *testing.T) {
+	calls := new(int32)
+	release := make(chan struct{})
+	cp := newProviderCache(time.Minute, nil).wrap(testCacheProvider{key: "repo", release: release, calls: calls})
+
+	// The first collection is held back until the others are waiting on it
+	// or, if they are late, have a fresh entry to read.
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = collectCached(t, cp)
+		}(i)
+		if i == 0 {
+			for atomic.LoadInt32(calls) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	for i, result := range results {
+		if result != int32(1) {
+			t.Errorf("collection %d printed %v, expected the shared 1", i, result)
+		}
+	}
+	if got := collectCached(t, cp); got != int32(1) || atomic.LoadInt32(calls) != 1 {
+		t.Errorf("fresh entry collected again (%v, %v calls)", got, atomic.LoadInt32(calls))
+	}
+}
+
+func TestProviderCacheTTL(t *testing.T) {
+	calls := new(int32)
+	cp := newProviderCache(20*time.Millisecond, nil).wrap(testCacheProvider{key: "repo", calls: calls})
+
+	collectCached(t, cp)
+	collectCached(t, cp)
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("%d collections before the ttl, expected 1", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if got := collectCached(t, cp); got != int32(2) {
+		t.Errorf("expired entry printed %v, expected 2", got)
+	}
+}
+
+func TestProviderCacheUncached(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		p    testCacheProvider
+	}{
+		{"failed", testCacheProvider{key: "repo", fail: true}},
+		{"no key", testCacheProvider{key: ""}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.p.calls = new(int32)
+			cp := newProviderCache(time.Minute, nil).wrap(tc.p)
+
+			for i := 1; i <= 3; i++ {
+				if got := collectCached(t, cp); got != int32(i) {
+					t.Errorf("collection %d printed %v", i, got)
+				}
+			}
+		})
+	}
+}
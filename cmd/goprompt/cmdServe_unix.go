@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// serveOwned reports if the file is owned by the current user.
+func serveOwned(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
+
+// serveListenPrivate listens on a socket created without group and other
+// permissions from the start, rather than chmod-ed after the fact.
+func serveListenPrivate(socketPath string) (net.Listener, error) {
+	umask := syscall.Umask(0177)
+	defer syscall.Umask(umask)
+
+	return net.Listen("unix", socketPath)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config is the effective goprompt configuration, which is the result of
+// overlaying the user config file on top of defaultConfig.
+type config struct {
+	TimeFormat string `toml:"time_format"`
+
+	Query  configQuery  `toml:"query"`
+	Render configRender `toml:"render"`
+	Serve  configServe  `toml:"serve"`
+	Lang   configLang   `toml:"lang"`
+	K8s    configK8s    `toml:"k8s"`
+}
+
+type configQuery struct {
+	Enable  []string `toml:"enable"`
+	Disable []string `toml:"disable"`
+
+	PrinterFirstDelay time.Duration `toml:"printer_first_delay"`
+	PrinterDelay      time.Duration `toml:"printer_delay"`
+
+	// Timeouts bounds the run time of individual providers by name, a
+	// provider without an entry only obeys the overall --timeout.
+	Timeouts map[string]time.Duration `toml:"timeouts"`
+}
+
+type configRender struct {
+	Top    []string `toml:"top"`
+	Bottom []string `toml:"bottom"`
+
+	// Colors maps palette slots (red, green, ...) to a color name, a 256
+	// color number or a #hex value.
+	Colors map[string]string `toml:"colors"`
+}
+
+type configServe struct {
+	// Socket is the unix socket `goprompt serve` listens on, defaults to
+	// $XDG_RUNTIME_DIR/goprompt/goprompt.sock (or $TMPDIR/goprompt-<uid>/).
+	// Its directory must be owned by the user and not writable by others.
+	Socket string `toml:"socket"`
+
+	// CacheTTL is how long repository level results are shared between
+	// shells before being collected again. Results of watched repositories
+	// are instead kept until a change is observed.
+	CacheTTL time.Duration `toml:"cache_ttl"`
+
+	// Watch enables filesystem watches (inotify) for cache invalidation,
+	// limited to WatchMaxDirs watched directories in total. Repositories that
+	// do not fit fall back to CacheTTL.
+	Watch        bool `toml:"watch"`
+	WatchMaxDirs int  `toml:"watch_max_dirs"`
+}
+
+type configLang struct {
+	// Exec additionally runs the toolchains found (`go version`, ...) to
+	// report the versions actually in use, bounded by query.timeouts.lang.
+	Exec bool `toml:"exec"`
+}
+
+type configK8s struct {
+	// ProductionPattern is a regular expression, contexts matching it are
+	// rendered in red.
+	ProductionPattern string `toml:"production_pattern"`
+}
+
+func defaultConfig() config {
+	return config{
+		TimeFormat: "15:04:05 01/02/06",
+		Query: configQuery{
+			Enable:            []string{},
+			Disable:           []string{},
+			PrinterFirstDelay: 20 * time.Millisecond,
+			PrinterDelay:      100 * time.Millisecond,
+			Timeouts: map[string]time.Duration{
+				"git":     2 * time.Second,
+				"sapling": 2 * time.Second,
+				"hg":      2 * time.Second,
+				"jj":      2 * time.Second,
+				"stg":     500 * time.Millisecond,
+				"lang":    time.Second,
+				"mux":     500 * time.Millisecond,
+			},
+		},
+		Render: configRender{
+			Top:    []string{"git", "sapling", "hg", "jj", "stg", "lang"},
+			Bottom: []string{"container", "identity", "status", "depth", "parent", "wd", "venv", "k8s", "aws", "gcp", "azure", "duration", "timestamp", "remote"},
+			Colors: map[string]string{
+				"red":     "red",
+				"green":   "green",
+				"yellow":  "yellow",
+				"blue":    "blue",
+				"magenta": "magenta",
+				"grey":    "black",
+			},
+		},
+		K8s: configK8s{
+			ProductionPattern: `(?i)prod`,
+		},
+		Serve: configServe{
+			CacheTTL:     1 * time.Second,
+			Watch:        true,
+			WatchMaxDirs: 4096,
+		},
+	}
+}
+
+var (
+	cfg    = defaultConfig()
+	cfgErr error
+)
+
+// configPath returns the location of the config file, which can be overridden
+// via GOPROMPT_CONFIG.
+func configPath() string {
+	if p := os.Getenv("GOPROMPT_CONFIG"); p != "" {
+		return p
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "goprompt", "config.toml")
+}
+
+// loadConfig reads the config file at path on top of the defaults. A missing
+// file is not an error.
+func loadConfig(path string) (config, error) {
+	c := defaultConfig()
+	if path == "" {
+		return c, nil
+	}
+
+	if _, err := toml.DecodeFile(path, &c); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return defaultConfig(), nil
+		}
+		return defaultConfig(), err
+	}
+	return c, nil
+}
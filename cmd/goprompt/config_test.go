@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	t.Setenv("GOPROMPT_CONFIG", path)
+	if configPath() != path {
+		t.Fatalf("configPath() = %v, expected GOPROMPT_CONFIG", configPath())
+	}
+
+	c, err := loadConfig(configPath())
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	if !reflect.DeepEqual(c, defaultConfig()) {
+		t.Errorf("missing file did not give the defaults: %+v", c)
+	}
+
+	if err := os.WriteFile(path, []byte(`
+[query]
+disable = ["k8s"]
+
+[query.timeouts]
+git = "5s"
+venv = "150ms"
+
+[render]
+bottom = ["status", "wd"]
+
+[render.colors]
+red = "#ff0000"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = loadConfig(configPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := defaultConfig()
+
+	// Maps are merged into the defaults.
+	if c.Query.Timeouts["git"] != 5*time.Second || c.Query.Timeouts["venv"] != 150*time.Millisecond {
+		t.Errorf("timeouts not overridden: %v", c.Query.Timeouts)
+	}
+	if c.Query.Timeouts["stg"] != defaults.Query.Timeouts["stg"] {
+		t.Errorf("default timeouts dropped: %v", c.Query.Timeouts)
+	}
+	if c.Render.Colors["red"] != "#ff0000" || c.Render.Colors["blue"] != defaults.Render.Colors["blue"] {
+		t.Errorf("colors not merged: %v", c.Render.Colors)
+	}
+
+	// Slices replace the defaults.
+	if !reflect.DeepEqual(c.Query.Disable, []string{"k8s"}) {
+		t.Errorf("disable = %v", c.Query.Disable)
+	}
+	if !reflect.DeepEqual(c.Render.Bottom, []string{"status", "wd"}) {
+		t.Errorf("bottom = %v", c.Render.Bottom)
+	}
+	if !reflect.DeepEqual(c.Render.Top, defaults.Render.Top) {
+		t.Errorf("top = %v, expected the default", c.Render.Top)
+	}
+
+	// Untouched sections keep their defaults.
+	if c.TimeFormat != defaults.TimeFormat || c.Serve != defaults.Serve {
+		t.Errorf("defaults not kept: %+v", c)
+	}
+
+	if err := os.WriteFile(path, []byte("[query\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := loadConfig(configPath()); err == nil || !reflect.DeepEqual(c, defaultConfig()) {
+		t.Errorf("invalid file = %+v, %v, expected the defaults and an error", c, err)
+	}
+}
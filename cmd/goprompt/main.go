@@ -34,9 +34,18 @@ func debugLog(msg string, args ...[]interface{}) {
 }
 
 func init() {
+	cmd.PersistentPreRun = func(*cobra.Command, []string) {
+		cfg, cfgErr = loadConfig(configPath())
+		if cfgErr != nil {
+			debugLog("config: " + cfgErr.Error())
+		}
+	}
+
 	cmd.AddCommand(cmdQuery)
 	cmd.AddCommand(cmdRender)
 	cmd.AddCommand(cmdInstall)
+	cmd.AddCommand(cmdConfig)
+	cmd.AddCommand(cmdServe)
 }
 
 func main() {
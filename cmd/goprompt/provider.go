@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partPrinter emits a single key/value pair of the query protocol.
+type partPrinter func(name string, value interface{})
+
+// Provider is a single source of prompt segments (vcs, process info, etc).
+//
+// Providers are registered via registerProvider (usually from init) and are
+// run concurrently by `goprompt query`. Detect decides if Collect should run at
+// all for the session described by q, it is not bounded by the provider
+// timeout and must not run commands: checks that need them belong in Collect.
+type Provider interface {
+	Name() string
+	Detect(ctx context.Context, q *queryEnv) bool
+	Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error
+}
+
+var providers []Provider
+
+func registerProvider(p Provider) {
+	for _, existing := range providers {
+		if existing.Name() == p.Name() {
+			panic(fmt.Sprintf("provider %q registered twice", p.Name()))
+		}
+	}
+	providers = append(providers, p)
+}
+
+func providerNames() []string {
+	var names []string
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectProviders filters the registered providers down to the ones that
+// should run, given the list of explicitly enabled and disabled names.
+// An empty enable list means all providers are enabled.
+func selectProviders(enable, disable []string) ([]Provider, error) {
+	known := make(map[string]bool)
+	for _, p := range providers {
+		known[p.Name()] = true
+	}
+
+	toSet := func(names []string) (map[string]bool, error) {
+		set := make(map[string]bool)
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !known[name] {
+				return nil, fmt.Errorf("unknown provider %q (available: %s)",
+					name, strings.Join(providerNames(), ", "))
+			}
+			set[name] = true
+		}
+		return set, nil
+	}
+
+	enableSet, err := toSet(enable)
+	if err != nil {
+		return nil, err
+	}
+	disableSet, err := toSet(disable)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []Provider
+	for _, p := range providers {
+		if len(enableSet) > 0 && !enableSet[p.Name()] {
+			continue
+		}
+		if disableSet[p.Name()] {
+			continue
+		}
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
+
+// runProvider runs detection and collection for a single provider, the latter
+// bounded by the given timeout (no timeout if zero). When the provider is cut
+// off any parts it has already printed are kept, anything it prints afterwards
+// is dropped and "<name>_state timeout" is emitted instead.
+func runProvider(ctx context.Context, q *queryEnv, p Provider, timeout time.Duration, printPart partPrinter) {
+	// Detect does not run commands, and a provider that does not apply can
+	// not time out.
+	if !p.Detect(ctx, q) {
+		return
+	}
+
+	if timeout > 0 {
+		var ctxCancel context.CancelFunc
+		ctx, ctxCancel = context.WithTimeout(ctx, timeout)
+		defer ctxCancel()
+	}
+
+	var printMu sync.Mutex
+	printCutOff := false
+	providerPrintPart := func(name string, value interface{}) {
+		printMu.Lock()
+		defer printMu.Unlock()
+
+		if printCutOff {
+			return
+		}
+		printPart(name, value)
+	}
+
+	// Only a provider that was still running at the deadline is cut off, one
+	// that finished right at the deadline is complete.
+	finished := false
+	doneSIG := make(chan struct{})
+	go func() {
+		defer close(doneSIG)
+
+		if err := p.Collect(ctx, q, providerPrintPart); err != nil {
+			debugLog(fmt.Sprintf("query: provider %s: %v", p.Name(), err))
+		}
+		finished = ctx.Err() == nil
+	}()
+
+	select {
+	case <-doneSIG:
+	case <-ctx.Done():
+	}
+
+	cutOff := true
+	select {
+	case <-doneSIG:
+		cutOff = !finished
+	default:
+	}
+
+	printMu.Lock()
+	defer printMu.Unlock()
+
+	printCutOff = true
+	if cutOff {
+		debugLog(fmt.Sprintf("query: provider %s: %v", p.Name(), ctx.Err()))
+		printPart(p.Name()+_partProviderStateSuffix, "timeout")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// providerAWS reports the active AWS profile and region, from the environment
+// and the shared config file.
+type providerAWS struct{}
+
+func init() {
+	registerProvider(providerAWS{})
+}
+
+func (providerAWS) Name() string {
+	return "aws"
+}
+
+func (providerAWS) Detect(_ context.Context, q *queryEnv) bool {
+	return awsProfile(q) != "" || awsEnvRegion(q) != ""
+}
+
+func awsProfile(q *queryEnv) string {
+	if profile := q.getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return q.getenv("AWS_DEFAULT_PROFILE")
+}
+
+func awsEnvRegion(q *queryEnv) string {
+	if region := q.getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return q.getenv("AWS_DEFAULT_REGION")
+}
+
+func (providerAWS) Collect(_ context.Context, q *queryEnv, printPart partPrinter) error {
+	profile := awsProfile(q)
+	if profile != "" {
+		printPart(_partAWSProfile, profile)
+	}
+
+	region := awsEnvRegion(q)
+	if region == "" {
+		configPath := q.getenv("AWS_CONFIG_FILE")
+		if configPath == "" {
+			configPath = filepath.Join(q.getenv("HOME"), ".aws", "config")
+		}
+
+		// The default profile is the only one without the "profile "
+		// prefix in the config file.
+		section := "default"
+		if profile != "" && profile != "default" {
+			section = "profile " + profile
+		}
+		if awsConfig, err := readINI(configPath); err == nil {
+			region = awsConfig[section]["region"]
+		}
+	}
+	if region != "" {
+		printPart(_partAWSRegion, region)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// providerAzure reports the default Azure subscription, from the profile of
+// the az CLI.
+type providerAzure struct{}
+
+func init() {
+	registerProvider(providerAzure{})
+}
+
+func (providerAzure) Name() string {
+	return "azure"
+}
+
+func azureProfilePath(q *queryEnv) string {
+	configDir := q.getenv("AZURE_CONFIG_DIR")
+	if configDir == "" {
+		configDir = filepath.Join(q.getenv("HOME"), ".azure")
+	}
+	return filepath.Join(configDir, "azureProfile.json")
+}
+
+func (providerAzure) Detect(_ context.Context, q *queryEnv) bool {
+	_, err := os.Stat(azureProfilePath(q))
+	return err == nil
+}
+
+func (providerAzure) Collect(_ context.Context, q *queryEnv, printPart partPrinter) error {
+	b, err := os.ReadFile(azureProfilePath(q))
+	if err != nil {
+		return nil
+	}
+
+	var profile struct {
+		Subscriptions []struct {
+			ID        string `json:"id"`
+			Name      string `json:"name"`
+			IsDefault bool   `json:"isDefault"`
+			User      struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"subscriptions"`
+	}
+	// az writes the file with a byte order mark.
+	if err := json.Unmarshal(bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")), &profile); err != nil {
+		return err
+	}
+
+	for _, sub := range profile.Subscriptions {
+		if !sub.IsDefault {
+			continue
+		}
+		printPart(_partAzureSubscription, sub.Name)
+		printPart(_partAzureSubscriptionID, sub.ID)
+		if sub.User.Name != "" {
+			printPart(_partAzureUser, sub.User.Name)
+		}
+		break
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// providerContainer reports the container (or Nix shell) the session runs in.
+type providerContainer struct{}
+
+func init() {
+	registerProvider(providerContainer{})
+}
+
+func (providerContainer) Name() string {
+	return "container"
+}
+
+func (providerContainer) Detect(context.Context, *queryEnv) bool {
+	return true
+}
+
+func containerExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func containerRead(name string) string {
+	b, _ := os.ReadFile(name)
+	return strings.TrimSpace(string(b))
+}
+
+// detectContainer returns the kind of container (docker, podman, ...) and its
+// name if known.
+func detectContainer(q *queryEnv) (kind string, name string) {
+	// /run/.containerenv is written by podman, which toolbox and
+	// distrobox build on.
+	if containerExists("/run/.containerenv") {
+		containerEnv := readContainerEnv(containerRead("/run/.containerenv"))
+		name = containerEnv["name"]
+
+		switch {
+		case q.getenv("DISTROBOX_ENTER_PATH") != "" || containerExists("/run/.distrobox"):
+			if id := q.getenv("CONTAINER_ID"); id != "" {
+				name = id
+			}
+			return "distrobox", name
+		case containerExists("/run/.toolboxenv"):
+			return "toolbox", name
+		}
+		return "podman", name
+	}
+
+	if containerExists("/.dockerenv") {
+		return "docker", ""
+	}
+
+	// Set by systemd-nspawn, lxc and others following the container
+	// interface of systemd.
+	if kind := containerRead("/run/systemd/container"); kind != "" {
+		if kind == "systemd-nspawn" {
+			name, _ = os.Hostname()
+		}
+		return kind, name
+	}
+
+	if q.getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes", ""
+	}
+
+	// Only cgroup v1 paths tell anything about the container runtime.
+	cgroup := containerRead("/proc/1/cgroup")
+	for _, hint := range []struct{ pattern, kind string }{
+		{"kubepods", "kubernetes"},
+		{"docker", "docker"},
+		{"libpod", "podman"},
+		{"containerd", "containerd"},
+		{"lxc", "lxc"},
+	} {
+		if strings.Contains(cgroup, hint.pattern) {
+			return hint.kind, ""
+		}
+	}
+
+	return "", ""
+}
+
+// readContainerEnv parses the key="value" lines of /run/.containerenv.
+func readContainerEnv(content string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = strings.Trim(value, `"`)
+		}
+	}
+	return values
+}
+
+func (providerContainer) Collect(_ context.Context, q *queryEnv, printPart partPrinter) error {
+	kind, name := detectContainer(q)
+
+	// A Nix shell is the closest thing to a container when not in one.
+	if kind == "" {
+		if q.getenv("IN_NIX_SHELL") != "" {
+			kind, name = "nix", q.getenv("name")
+		}
+	}
+
+	if kind == "" {
+		return nil
+	}
+
+	printPart(_partEnvContainer, kind)
+	if name != "" {
+		printPart(_partEnvContainerName, name)
+	}
+	return nil
+}
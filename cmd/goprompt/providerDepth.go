@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// providerDepth reports how many shells deep the prompt is, e.g. a shell
+// started from vim `:sh` within the login shell is at depth 2.
+type providerDepth struct{}
+
+func init() {
+	registerProvider(providerDepth{})
+}
+
+func (providerDepth) Name() string {
+	return "depth"
+}
+
+func (providerDepth) Detect(context.Context, *queryEnv) bool {
+	return true
+}
+
+// depthShells are the process names counted as a level of nesting.
+var depthShells = map[string]bool{
+	"sh":     true,
+	"ash":    true,
+	"dash":   true,
+	"bash":   true,
+	"zsh":    true,
+	"ksh":    true,
+	"mksh":   true,
+	"yash":   true,
+	"csh":    true,
+	"tcsh":   true,
+	"fish":   true,
+	"nu":     true,
+	"elvish": true,
+	"xonsh":  true,
+	"pwsh":   true,
+}
+
+// isShell tells whether the process name is that of a shell, login shells
+// included (-zsh).
+func isShell(name string) bool {
+	return depthShells[strings.TrimPrefix(name, "-")]
+}
+
+func (providerDepth) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	// Shells in the chain starting with the one showing the prompt, the
+	// processes below it are the subshells running the query.
+	depth := 0
+	psChain, _ := q.processChain(ctx)
+	for psIdx, ps := range psChain {
+		if psIdx-q.PidParentSkip < 1 || !ps.ok {
+			continue
+		}
+		if isShell(ps.Name) {
+			depth++
+		}
+	}
+
+	// SHLVL counts `exec zsh` as a level and is inherited by shells in new
+	// tmux windows, so it only ever lowers the count from the chain. It is
+	// all there is to go by when the chain could not be walked.
+	if shlvl := strInt(q.getenv("SHLVL")); shlvl > 0 {
+		if depth == 0 || shlvl < depth {
+			depth = shlvl
+		}
+	}
+
+	if depth == 0 {
+		return nil
+	}
+	printPart(_partShellDepth, depth)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// providerGCloud reports the active gcloud configuration and its project,
+// from the gcloud config directory.
+type providerGCloud struct{}
+
+func init() {
+	registerProvider(providerGCloud{})
+}
+
+func (providerGCloud) Name() string {
+	return "gcp"
+}
+
+func gcloudConfigDir(q *queryEnv) string {
+	if dir := q.getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return dir
+	}
+	return filepath.Join(q.getenv("HOME"), ".config", "gcloud")
+}
+
+func (providerGCloud) Detect(_ context.Context, q *queryEnv) bool {
+	if q.getenv("CLOUDSDK_ACTIVE_CONFIG_NAME") != "" || q.getenv("CLOUDSDK_CORE_PROJECT") != "" {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(gcloudConfigDir(q), "active_config"))
+	return err == nil
+}
+
+func (providerGCloud) Collect(_ context.Context, q *queryEnv, printPart partPrinter) error {
+	configDir := gcloudConfigDir(q)
+
+	name := q.getenv("CLOUDSDK_ACTIVE_CONFIG_NAME")
+	if name == "" {
+		b, _ := os.ReadFile(filepath.Join(configDir, "active_config"))
+		name = strings.TrimSpace(string(b))
+	}
+	if name == "" {
+		name = "default"
+	}
+	printPart(_partGCPConfig, name)
+
+	gcloudConfig, _ := readINI(filepath.Join(configDir, "configurations", "config_"+name))
+
+	project := q.getenv("CLOUDSDK_CORE_PROJECT")
+	if project == "" {
+		project = gcloudConfig["core"]["project"]
+	}
+	if project != "" {
+		printPart(_partGCPProject, project)
+	}
+	if account := gcloudConfig["core"]["account"]; account != "" {
+		printPart(_partGCPAccount, account)
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/NonLogicalDev/shell.async-goprompt/pkg/gitdir"
+	"github.com/NonLogicalDev/shell.async-goprompt/pkg/gitstatus"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// providerGit reports branch, dirty state, upstream distance and in-progress
+// operations of a git repository.
+type providerGit struct{}
+
+func init() {
+	registerProvider(providerGit{})
+}
+
+func (providerGit) Name() string {
+	return "git"
+}
+
+func (providerGit) Detect(_ context.Context, q *queryEnv) bool {
+	if kind, _ := vcsFindRoot(q.Wd); kind != "" && kind != "git" && q.getenv("GIT_DIR") == "" {
+		// A checkout of another VCS nested in (or colocated with) a git
+		// repository.
+		return false
+	}
+	if gitRepo(q) != nil {
+		return true
+	}
+	// Layouts only git itself understands are left for Collect to check,
+	// within the provider timeout.
+	if q.getenv("GIT_DIR") != "" || q.getenv("GIT_WORK_TREE") != "" {
+		return true
+	}
+	_, ok := findUp(q.Wd, ".git")
+	return ok
+}
+
+func (providerGit) CacheKey(q *queryEnv) string {
+	if repo := gitRepo(q); repo != nil && repo.WorkTree == "" {
+		// Inside the git dir, which is reported differently from the
+		// work tree.
+		return repo.GitDir
+	}
+	root, _ := findUp(q.Wd, ".git")
+	return root
+}
+
+func (providerGit) WatchSpec(_ *queryEnv, root string) watchSpec {
+	return gitWatchSpec(root)
+}
+
+func (providerGit) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	subTasks := mkWgPool(ctx)
+	defer subTasks.Wait()
+
+	// Reading the git dir directly gets the branch out before any of the
+	// git processes below finish.
+	repo := gitRepo(q)
+
+	// Otherwise git has the final say on whether this is a repository.
+	var revParse string
+	if repo == nil {
+		out, err := q.stringExec(ctx, "git", "rev-parse", "--path-format=absolute",
+			"--git-dir", "--is-bare-repository", "--is-inside-git-dir", "--show-superproject-working-tree")
+		if err != nil {
+			return nil
+		}
+		revParse = out
+	}
+
+	printPart(_partVcs, "git")
+
+	// dirRepo is read even when git has to be asked where the git dir is.
+	dirRepo := repo
+	if repo != nil {
+		gitPrintLayout(repo.LinkedWorktree(), repo.Superproject(), repo.Bare, repo.WorkTree == "", printPart)
+	} else {
+		if lines := strings.Split(revParse, "\n"); len(lines) >= 3 {
+			dirRepo, _ = gitdir.Open("", lines[0])
+
+			worktree, superproject := "", ""
+			if dirRepo != nil {
+				worktree = dirRepo.LinkedWorktree()
+			}
+			if len(lines) > 3 {
+				superproject = lines[3]
+			}
+			gitPrintLayout(worktree, superproject, lines[1] == "true", lines[2] == "true", printPart)
+		}
+	}
+
+	var op *gitdir.Operation
+	if dirRepo != nil {
+		op = dirRepo.Operation()
+	}
+
+	headRef := ""
+	if op != nil {
+		printPart(_partVcsGitRebaseOp, op.Name)
+		if op.Total > 0 {
+			printPart(_partVcsGitRebaseStep, op.Step)
+			printPart(_partVcsGitRebaseTotal, op.Total)
+		}
+		if op.Left > 0 {
+			printPart(_partVcsGitRebaseLeft, op.Left)
+		}
+		headRef = op.Head
+	}
+
+	branchPrinted := false
+	if op != nil && op.HeadName != "" {
+		printPart(_partVcsBranch, strings.TrimPrefix(op.HeadName, "refs/heads/"))
+		branchPrinted = true
+	} else if len(headRef) != 0 {
+		subTasks.Go(func(ctx context.Context) error {
+			branch, _ := q.stringExec(ctx, "git", "name-rev", "--name-only", headRef)
+			printPart(_partVcsBranch, branch)
+			return nil
+		})
+	} else if dirRepo != nil {
+		if head, err := dirRepo.Head(); err == nil {
+			if !head.Detached() {
+				printPart(_partVcsBranch, head.Branch())
+				branchPrinted = true
+			} else if head.OID != "" {
+				gitPrintDetached(&subTasks, q, dirRepo, head.OID, printPart)
+				branchPrinted = true
+			}
+		}
+	}
+
+	if dirRepo != nil {
+		if stashCount, err := dirRepo.StashCount(); err == nil && stashCount > 0 {
+			printPart(_partVcsGitStash, stashCount)
+		}
+	}
+
+	// Everything else comes from a single status call, which is the
+	// expensive one in large repositories.
+	subTasks.Go(func(ctx context.Context) error {
+		out, err := q.stringExec(ctx, "git", gitstatus.Args...)
+		if err != nil {
+			return nil
+		}
+
+		status, err := gitstatus.Parse([]byte(out))
+		if err != nil {
+			return err
+		}
+
+		if len(headRef) == 0 && !branchPrinted {
+			if status.Detached && status.OID != "" {
+				gitPrintDetached(&subTasks, q, dirRepo, status.OID, printPart)
+			} else {
+				printPart(_partVcsBranch, status.Head)
+			}
+		}
+
+		if status.Upstream != "" {
+			printPart(_partVcsGitUpstream, status.Upstream)
+		}
+		if status.HasAheadBehind {
+			printPart(_partVcsLogAhead, status.Ahead)
+			printPart(_partVcsLogBehind, status.Behind)
+		}
+
+		if !status.Dirty() {
+			printPart(_partVcsDirty, 0)
+			return nil
+		}
+
+		printPart(_partVcsDirty, 1)
+
+		printPart(_partVcsGitIdxTotal, status.Entries)
+		printPart(_partVcsGitIdxIncluded, status.Staged)
+		printPart(_partVcsGitIdxExcluded, status.Unstaged)
+
+		printPart(_partVcsGitIdxStaged, status.Staged)
+		printPart(_partVcsGitIdxUnstaged, status.Unstaged)
+		printPart(_partVcsGitIdxUntracked, status.Untracked)
+		printPart(_partVcsGitIdxConflicted, status.Conflicted)
+		printPart(_partVcsGitIdxRenamed, status.Renamed)
+
+		return nil
+	})
+
+	return nil
+}
+
+// gitPrintLayout prints where in the repository layout the session is: a
+// linked worktree, a submodule, a bare repository or inside the git dir.
+func gitPrintLayout(worktree, superproject string, bare, inGitDir bool, printPart partPrinter) {
+	if worktree != "" {
+		printPart(_partVcsGitWorktree, worktree)
+	}
+	if superproject != "" {
+		printPart(_partVcsGitSubmodule, superproject)
+	}
+	if bare {
+		printPart(_partVcsGitBare, 1)
+	} else if inGitDir {
+		printPart(_partVcsGitInGitDir, 1)
+	}
+}
+
+// gitPrintDetached prints the commit checked out on a detached HEAD and the
+// tag pointing at it, if any.
+func gitPrintDetached(subTasks *pool.ContextPool, q *queryEnv, repo *gitdir.Repo, oid string, printPart partPrinter) {
+	printPart(_partVcsGitDetached, 1)
+	printPart(_partVcsGitSha, oid[:intMin(len(oid), 7)])
+
+	if repo != nil {
+		if tags, ok, err := repo.TagsAt(oid); err == nil && ok {
+			if len(tags) > 0 {
+				printPart(_partVcsGitTag, tags[0])
+			}
+			return
+		}
+	}
+
+	subTasks.Go(func(ctx context.Context) error {
+		if tag, err := q.stringExec(ctx, "git", "describe", "--tags", "--exact-match", oid); err == nil {
+			printPart(_partVcsGitTag, tag)
+		}
+		return nil
+	})
+}
+
+// gitRepo finds the repository of the session's working directory, it
+// returns nil if it can not be read directly and git has to be asked.
+func gitRepo(q *queryEnv) *gitdir.Repo {
+	if q.getenv("GIT_DIR") != "" || q.getenv("GIT_WORK_TREE") != "" {
+		return nil
+	}
+
+	repo, err := gitdir.Find(q.Wd)
+	if err != nil {
+		return nil
+	}
+	return repo
+}
+
+// gitWatchSpec watches the git dir (index, HEAD, ...), refs and the working
+// tree of the repository at root.
+func gitWatchSpec(root string) watchSpec {
+	repo, err := gitdir.Find(root)
+	if err != nil {
+		return watchSpec{}
+	}
+
+	spec := watchSpec{
+		Dirs: []string{repo.GitDir},
+		Trees: []string{
+			filepath.Join(repo.CommonDir, "refs"),
+			filepath.Join(repo.CommonDir, "logs", "refs"),
+		},
+		Skip:      []string{repo.GitDir},
+		GitIgnore: true,
+	}
+	if repo.WorkTree != "" {
+		spec.Trees = append(spec.Trees, repo.WorkTree)
+	}
+	if repo.CommonDir != repo.GitDir {
+		// Linked worktree, packed-refs live in the common dir.
+		spec.Dirs = append(spec.Dirs, repo.CommonDir)
+		spec.Skip = append(spec.Skip, repo.CommonDir)
+	}
+	return spec
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// providerHg reports the state of a Mercurial checkout.
+type providerHg struct{}
+
+func init() {
+	registerProvider(providerHg{})
+}
+
+func (providerHg) Name() string {
+	return "hg"
+}
+
+func (providerHg) Detect(_ context.Context, q *queryEnv) bool {
+	kind, _ := vcsFindRoot(q.Wd)
+	return kind == "hg"
+}
+
+func (providerHg) CacheKey(q *queryEnv) string {
+	if kind, root := vcsFindRoot(q.Wd); kind == "hg" {
+		return root
+	}
+	return ""
+}
+
+func (providerHg) WatchSpec(_ *queryEnv, root string) watchSpec {
+	hgDir := filepath.Join(root, ".hg")
+	return watchSpec{
+		Dirs:  []string{hgDir},
+		Trees: []string{root},
+		Skip:  []string{hgDir},
+	}
+}
+
+func (providerHg) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	subTasks := mkWgPool(ctx)
+	defer subTasks.Wait()
+
+	_, root := vcsFindRoot(q.Wd)
+	hgDir := filepath.Join(root, ".hg")
+
+	printPart(_partVcs, "hg")
+
+	// Branch, bookmark and topic are plain files, which is a lot faster than
+	// starting hg.
+	hgRead := func(name string) string {
+		b, _ := os.ReadFile(filepath.Join(hgDir, name))
+		return strings.TrimSpace(string(b))
+	}
+
+	branch := hgRead("branch")
+	if branch == "" {
+		branch = "default"
+	}
+	printPart(_partVcsBranch, branch)
+
+	if bookmark := hgRead("bookmarks.current"); bookmark != "" {
+		printPart(_partVcsHgBookmark, bookmark)
+	}
+	if topic := hgRead("topic"); topic != "" {
+		printPart(_partVcsHgTopic, topic)
+	}
+
+	subTasks.Go(func(ctx context.Context) error {
+		if revInfo, err := q.stringExec(ctx, "hg", "log", "-r", ".", "--template", `{node|short}\t{phase}`); err == nil {
+			node, phase, _ := strings.Cut(revInfo, "\t")
+			printPart(_partVcsHgNode, node)
+			printPart(_partVcsHgPhase, phase)
+		}
+		return nil
+	})
+
+	subTasks.Go(func(ctx context.Context) error {
+		if hgStatus, err := q.stringExec(ctx, "hg", "status"); err == nil {
+			if len(hgStatus) == 0 {
+				printPart(_partVcsDirty, 0)
+				return nil
+			}
+
+			printPart(_partVcsDirty, 1)
+		}
+		return nil
+	})
+
+	return nil
+}
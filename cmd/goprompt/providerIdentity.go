@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"os/user"
+	"strconv"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// providerIdentity reports the effective user of the shell and the user it
+// was elevated from (sudo, su, ...), if any.
+type providerIdentity struct{}
+
+func init() {
+	registerProvider(providerIdentity{})
+}
+
+func (providerIdentity) Name() string {
+	return "identity"
+}
+
+func (providerIdentity) Detect(context.Context, *queryEnv) bool {
+	return true
+}
+
+// identityElevators are the programs that start a shell as another user.
+var identityElevators = map[string]bool{
+	"sudo":   true,
+	"su":     true,
+	"doas":   true,
+	"run0":   true,
+	"pkexec": true,
+}
+
+// psUid returns the real or effective uid of the process.
+func psUid(ctx context.Context, ps *process.Process, effective bool) (int32, bool) {
+	uids, err := ps.UidsWithContext(ctx)
+	if err != nil || len(uids) < 2 {
+		return 0, false
+	}
+	if effective {
+		return uids[1], true
+	}
+	return uids[0], true
+}
+
+func identityUsername(uid int32) string {
+	u, err := user.LookupId(strconv.Itoa(int(uid)))
+	if err != nil {
+		return strconv.Itoa(int(uid))
+	}
+	return u.Username
+}
+
+func (providerIdentity) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	// The uid of the querying process rather than our own, which is what
+	// `goprompt serve` would see.
+	psQuery, err := process.NewProcessWithContext(ctx, int32(q.Pid))
+	if err != nil {
+		return err
+	}
+	euid, ok := psUid(ctx, psQuery, true)
+	if !ok {
+		return nil
+	}
+
+	username := identityUsername(euid)
+	printPart(_partUserName, username)
+	if euid == 0 {
+		printPart(_partUserIsRoot, 1)
+	} else {
+		printPart(_partUserIsRoot, 0)
+	}
+
+	elevatedFrom := ""
+	if sudoUser := q.getenv("SUDO_USER"); sudoUser != "" && sudoUser != username {
+		elevatedFrom = sudoUser
+	} else {
+		// The original user owns the first process above su/sudo that runs
+		// as someone else, which also works when the environment was reset
+		// (`su -`, doas, ...).
+		psChain, _ := q.processChain(ctx)
+		elevated := false
+		for _, ps := range psChain {
+			if !ps.ok {
+				continue
+			}
+			if identityElevators[ps.Name] {
+				elevated = true
+			}
+			if !elevated {
+				continue
+			}
+			if uid, ok := psUid(ctx, ps.Process, false); ok && uid != euid {
+				elevatedFrom = identityUsername(uid)
+				break
+			}
+		}
+	}
+	if elevatedFrom == "" {
+		if logname := q.getenv("LOGNAME"); logname != "" && logname != username {
+			elevatedFrom = logname
+		}
+	}
+
+	if elevatedFrom != "" {
+		printPart(_partUserElevatedFrom, elevatedFrom)
+	}
+	return nil
+}
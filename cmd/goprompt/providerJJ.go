@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// providerJJ reports the state of the working copy commit of a Jujutsu (jj)
+// repository, including ones colocated with git.
+type providerJJ struct{}
+
+func init() {
+	registerProvider(providerJJ{})
+}
+
+func (providerJJ) Name() string {
+	return "jj"
+}
+
+func (providerJJ) Detect(_ context.Context, q *queryEnv) bool {
+	kind, _ := vcsFindRoot(q.Wd)
+	return kind == "jj"
+}
+
+func (providerJJ) CacheKey(q *queryEnv) string {
+	if kind, root := vcsFindRoot(q.Wd); kind == "jj" {
+		return root
+	}
+	return ""
+}
+
+func (providerJJ) WatchSpec(_ *queryEnv, root string) watchSpec {
+	jjDir := filepath.Join(root, ".jj")
+	gitDir := filepath.Join(root, ".git")
+	// Not .jj/working_copy, whose lock file is written by every jj
+	// invocation including Collect. Operations that change the repository
+	// replace the heads, and changes to the files show up in the work tree.
+	return watchSpec{
+		Dirs:      []string{filepath.Join(jjDir, "repo", "op_heads", "heads")},
+		Trees:     []string{root},
+		Skip:      []string{jjDir, gitDir},
+		GitIgnore: true,
+	}
+}
+
+// jjTemplate prints the fields read by providerJJ.Collect, tab separated.
+const jjTemplate = `separate("\t",
+	change_id.shortest(8),
+	commit_id.shortest(8),
+	if(empty, "1", "0"),
+	if(conflict, "1", "0"),
+	if(description, "1", "0"),
+	bookmarks.join(","),
+)`
+
+func (providerJJ) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	printPart(_partVcs, "jj")
+
+	// A single jj invocation, as each one snapshots the working copy.
+	out, err := q.stringExec(ctx, "jj", "log", "-r", "@", "--no-graph", "--color", "never", "-T", jjTemplate)
+	if err != nil {
+		return nil
+	}
+
+	info := strings.Split(out, "\t")
+	if len(info) < 5 {
+		return nil
+	}
+
+	printPart(_partVcsJJChange, info[0])
+	printPart(_partVcsJJCommit, info[1])
+	printPart(_partVcsJJEmpty, info[2])
+	printPart(_partVcsJJConflict, info[3])
+	printPart(_partVcsJJDescribed, info[4])
+	if len(info) > 5 && info[5] != "" {
+		printPart(_partVcsJJBookmarks, info[5])
+	}
+
+	if info[2] == "1" {
+		printPart(_partVcsDirty, 0)
+	} else {
+		printPart(_partVcsDirty, 1)
+	}
+
+	return nil
+}
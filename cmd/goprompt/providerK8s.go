@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// providerK8s reports the current Kubernetes context and namespace, parsed
+// from the kubeconfig files without running kubectl.
+type providerK8s struct{}
+
+func init() {
+	registerProvider(providerK8s{})
+}
+
+func (providerK8s) Name() string {
+	return "k8s"
+}
+
+func (providerK8s) Detect(_ context.Context, q *queryEnv) bool {
+	for _, path := range kubeconfigPaths(q) {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// kubeconfig is the part of a kubeconfig file needed for the prompt.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// kubeconfigPaths returns the files listed in $KUBECONFIG, or the default
+// ~/.kube/config.
+func kubeconfigPaths(q *queryEnv) []string {
+	if env := q.getenv("KUBECONFIG"); env != "" {
+		var paths []string
+		for _, path := range filepath.SplitList(env) {
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+
+	if homeDir := q.getenv("HOME"); homeDir != "" {
+		return []string{filepath.Join(homeDir, ".kube", "config")}
+	}
+	return nil
+}
+
+func (providerK8s) Collect(_ context.Context, q *queryEnv, printPart partPrinter) error {
+	// Merged like kubectl does: the first file to set current-context wins,
+	// and so does the first file to define a context of a given name.
+	var currentContext string
+	namespaces := make(map[string]string)
+	for _, path := range kubeconfigPaths(q) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var config kubeconfig
+		if err := yaml.Unmarshal(b, &config); err != nil {
+			debugLog("k8s: " + path + ": " + err.Error())
+			continue
+		}
+
+		if currentContext == "" {
+			currentContext = config.CurrentContext
+		}
+		for _, c := range config.Contexts {
+			if _, ok := namespaces[c.Name]; !ok {
+				namespaces[c.Name] = c.Context.Namespace
+			}
+		}
+	}
+
+	if currentContext == "" {
+		return nil
+	}
+	printPart(_partK8sContext, currentContext)
+
+	namespace, ok := namespaces[currentContext]
+	if !ok {
+		return nil
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	printPart(_partK8sNamespace, namespace)
+
+	return nil
+}
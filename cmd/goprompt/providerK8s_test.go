@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProviderK8s(t *testing.T) {
+	const (
+		prod = `
+current-context: prod
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    namespace: web
+`
+		dev = `
+contexts:
+- name: dev
+  context:
+    cluster: dev
+- name: prod
+  context:
+    cluster: prod
+    namespace: other
+`
+		devCurrent = "current-context: dev\n" + dev
+	)
+
+	for _, tc := range []struct {
+		desc     string
+		files    []string // "" for a missing file
+		expected map[string]interface{}
+	}{
+		{
+			desc:  "missing",
+			files: []string{""},
+		},
+		{
+			desc:     "single file",
+			files:    []string{prod},
+			expected: map[string]interface{}{_partK8sContext: "prod", _partK8sNamespace: "web"},
+		},
+		{
+			desc:     "default namespace",
+			files:    []string{devCurrent},
+			expected: map[string]interface{}{_partK8sContext: "dev", _partK8sNamespace: "default"},
+		},
+		{
+			desc:     "current-context in a later file",
+			files:    []string{"", dev, "current-context: dev\n"},
+			expected: map[string]interface{}{_partK8sContext: "dev", _partK8sNamespace: "default"},
+		},
+		{
+			desc:     "first current-context wins",
+			files:    []string{prod, devCurrent},
+			expected: map[string]interface{}{_partK8sContext: "prod", _partK8sNamespace: "web"},
+		},
+		{
+			desc:     "first context of a name wins",
+			files:    []string{dev, prod},
+			expected: map[string]interface{}{_partK8sContext: "prod", _partK8sNamespace: "other"},
+		},
+		{
+			desc:     "undefined context",
+			files:    []string{"current-context: gone\n", "contexts: [\n", dev},
+			expected: map[string]interface{}{_partK8sContext: "gone"},
+		},
+	} {
+		dir := t.TempDir()
+		var paths []string
+		for i, data := range tc.files {
+			path := filepath.Join(dir, "config"+string(rune('a'+i)))
+			paths = append(paths, path)
+			if data == "" {
+				continue
+			}
+			if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		q := &queryEnv{Env: map[string]string{
+			"KUBECONFIG": strings.Join(paths, string(filepath.ListSeparator)),
+		}}
+		var tp testParts
+		if err := (providerK8s{}).Collect(context.Background(), q, tp.printPart); err != nil {
+			t.Errorf("%s: Collect() = %v", tc.desc, err)
+		}
+		if !reflect.DeepEqual(tp.parts, tc.expected) {
+			t.Errorf("%s: printed %v, expected %v", tc.desc, tp.parts, tc.expected)
+		}
+	}
+}
+
+func TestKubeconfigPaths(t *testing.T) {
+	sep := string(filepath.ListSeparator)
+	for _, tc := range []struct {
+		env      map[string]string
+		expected []string
+	}{
+		{map[string]string{}, nil},
+		{map[string]string{"HOME": "/home/u"}, []string{filepath.Join("/home/u", ".kube", "config")}},
+		{map[string]string{"HOME": "/home/u", "KUBECONFIG": "/a" + sep + sep + "/b"}, []string{"/a", "/b"}},
+	} {
+		if paths := kubeconfigPaths(&queryEnv{Env: tc.env}); !reflect.DeepEqual(paths, tc.expected) {
+			t.Errorf("kubeconfigPaths(%v) = %v, expected %v", tc.env, paths, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// providerLang reports the language toolchains a project asks for, read from
+// project files between the working directory and the checkout root.
+type providerLang struct{}
+
+func init() {
+	registerProvider(providerLang{})
+}
+
+func (providerLang) Name() string {
+	return "lang"
+}
+
+func (providerLang) Detect(context.Context, *queryEnv) bool {
+	return true
+}
+
+type langFile struct {
+	name  string
+	parse func(b []byte) string
+}
+
+type langToolchain struct {
+	// name is used for the lang_<name> keys.
+	name string
+	// files are looked for in each directory, in order.
+	files []langFile
+
+	// exec reports the version in use, see configLang.Exec.
+	exec      []string
+	parseExec func(out string) string
+}
+
+var langToolchains = []langToolchain{
+	{
+		name: "go",
+		files: []langFile{
+			{"go.work", parseGoModVersion},
+			{"go.mod", parseGoModVersion},
+		},
+		exec: []string{"go", "version"},
+		parseExec: func(out string) string {
+			// go version go1.22.3 linux/amd64
+			return strings.TrimPrefix(langField(out, 2), "go")
+		},
+	},
+	{
+		name: "node",
+		files: []langFile{
+			{".nvmrc", func(b []byte) string {
+				return strings.TrimPrefix(langFirstLine(b), "v")
+			}},
+			{"package.json", func(b []byte) string {
+				var pkg struct {
+					Engines struct {
+						Node string `json:"node"`
+					} `json:"engines"`
+				}
+				json.Unmarshal(b, &pkg)
+				return pkg.Engines.Node
+			}},
+		},
+		exec: []string{"node", "--version"},
+		parseExec: func(out string) string {
+			// v20.11.0
+			return strings.TrimPrefix(langField(out, 0), "v")
+		},
+	},
+	{
+		name: "python",
+		files: []langFile{
+			{".python-version", langFirstLine},
+			{"pyproject.toml", func(b []byte) string {
+				var pyproject struct {
+					Project struct {
+						RequiresPython string `toml:"requires-python"`
+					} `toml:"project"`
+					Tool struct {
+						Poetry struct {
+							Dependencies map[string]interface{} `toml:"dependencies"`
+						} `toml:"poetry"`
+					} `toml:"tool"`
+				}
+				if _, err := toml.Decode(string(b), &pyproject); err != nil {
+					return ""
+				}
+				if pyproject.Project.RequiresPython != "" {
+					return pyproject.Project.RequiresPython
+				}
+				python, _ := pyproject.Tool.Poetry.Dependencies["python"].(string)
+				return python
+			}},
+		},
+		exec: []string{"python3", "--version"},
+		parseExec: func(out string) string {
+			// Python 3.12.1
+			return langField(out, 1)
+		},
+	},
+	{
+		name: "rust",
+		files: []langFile{
+			{"rust-toolchain.toml", parseRustToolchain},
+			{"rust-toolchain", func(b []byte) string {
+				// The legacy file is either just the channel or toml.
+				if channel := parseRustToolchain(b); channel != "" {
+					return channel
+				}
+				return langFirstLine(b)
+			}},
+		},
+		exec: []string{"rustc", "--version"},
+		parseExec: func(out string) string {
+			// rustc 1.76.0 (07dca489a 2024-02-04)
+			return langField(out, 1)
+		},
+	},
+}
+
+func (providerLang) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	subTasks := mkWgPool(ctx)
+	defer subTasks.Wait()
+
+	dirs := langSearchDirs(q.Wd)
+	for _, lang := range langToolchains {
+		version, ok := lang.find(dirs)
+		if !ok {
+			continue
+		}
+
+		printPart(_partLangPrefix+lang.name, version)
+
+		if cfg.Lang.Exec {
+			lang := lang
+			subTasks.Go(func(ctx context.Context) error {
+				if out, err := q.stringExec(ctx, lang.exec[0], lang.exec[1:]...); err == nil {
+					if version := lang.parseExec(out); version != "" {
+						printPart(_partLangPrefix+lang.name+_partLangExecSuffix, version)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	return nil
+}
+
+// find returns the version from the closest project file, ok is set if any
+// was found even if it does not specify a version.
+func (lang langToolchain) find(dirs []string) (version string, ok bool) {
+	for _, dir := range dirs {
+		for _, file := range lang.files {
+			b, err := os.ReadFile(filepath.Join(dir, file.name))
+			if err != nil {
+				continue
+			}
+			ok = true
+			if version = file.parse(b); version != "" {
+				return version, true
+			}
+		}
+		if ok {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// langSearchDirs returns wd and its parents up to the checkout root, or just
+// wd outside of a checkout.
+func langSearchDirs(wd string) []string {
+	if wd == "" {
+		return nil
+	}
+
+	dir := filepath.Clean(wd)
+	_, root := vcsFindRoot(dir)
+	if root == "" {
+		return []string{dir}
+	}
+
+	var dirs []string
+	for {
+		dirs = append(dirs, dir)
+
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// parseGoModVersion returns the toolchain, or the go version of a go.mod or
+// go.work file.
+func parseGoModVersion(b []byte) string {
+	version := ""
+	scanner := bufio.NewScanner(strings.NewReader(string(b)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "toolchain":
+			return strings.TrimPrefix(fields[1], "go")
+		case "go":
+			version = fields[1]
+		}
+	}
+	return version
+}
+
+func parseRustToolchain(b []byte) string {
+	var toolchain struct {
+		Toolchain struct {
+			Channel string `toml:"channel"`
+		} `toml:"toolchain"`
+	}
+	if _, err := toml.Decode(string(b), &toolchain); err != nil {
+		return ""
+	}
+	return toolchain.Toolchain.Channel
+}
+
+// langFirstLine returns the first line that is not blank or a comment.
+func langFirstLine(b []byte) string {
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+func langField(s string, n int) string {
+	fields := strings.Fields(s)
+	if n < len(fields) {
+		return fields[n]
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseGoModVersion(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		mod      string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"go line", "module example.com/m\n\ngo 1.21\n", "1.21"},
+		{
+			desc:     "toolchain over go",
+			mod:      "module example.com/m\n\ngo 1.21\n\ntoolchain go1.22.3\n",
+			expected: "1.22.3",
+		},
+		{
+			desc:     "toolchain before go",
+			mod:      "toolchain go1.22.3\ngo 1.21\n",
+			expected: "1.22.3",
+		},
+		{
+			desc:     "go.work",
+			mod:      "go 1.22.0\n\nuse (\n\t./a\n\t./b\n)\n",
+			expected: "1.22.0",
+		},
+		{
+			desc: "directives in blocks",
+			mod: "module example.com/m\n\nrequire (\n\tgo.example.com/x v1.0.0\n)\n" +
+				"replace go => ./go\n",
+		},
+	} {
+		if v := parseGoModVersion([]byte(tc.mod)); v != tc.expected {
+			t.Errorf("%s: parseGoModVersion() = %q, expected %q", tc.desc, v, tc.expected)
+		}
+	}
+}
+
+func TestParseRustToolchain(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		file     string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"channel", "[toolchain]\nchannel = \"1.76.0\"\ncomponents = [\"rustfmt\"]\n", "1.76.0"},
+		{"no channel", "[toolchain]\nprofile = \"minimal\"\n", ""},
+		{"legacy", "nightly-2024-02-01\n", ""},
+	} {
+		if v := parseRustToolchain([]byte(tc.file)); v != tc.expected {
+			t.Errorf("%s: parseRustToolchain() = %q, expected %q", tc.desc, v, tc.expected)
+		}
+	}
+}
+
+func TestLangToolchainFind(t *testing.T) {
+	toolchains := make(map[string]langToolchain)
+	for _, lang := range langToolchains {
+		toolchains[lang.name] = lang
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		lang    string
+		files   map[string]string // relative to the parent of dir
+		version string
+		ok      bool
+	}{
+		{
+			desc: "none",
+			lang: "go",
+		},
+		{
+			desc:    "go.work over go.mod",
+			lang:    "go",
+			files:   map[string]string{"dir/go.work": "go 1.22\n", "dir/go.mod": "go 1.21\n"},
+			version: "1.22",
+			ok:      true,
+		},
+		{
+			desc:    "closest directory",
+			lang:    "go",
+			files:   map[string]string{"dir/go.mod": "go 1.21\n", "go.work": "go 1.22\n"},
+			version: "1.21",
+			ok:      true,
+		},
+		{
+			desc:    "parent directory",
+			lang:    "python",
+			files:   map[string]string{".python-version": "# pinned\n3.12.1\n"},
+			version: "3.12.1",
+			ok:      true,
+		},
+		{
+			desc:    "nvmrc",
+			lang:    "node",
+			files:   map[string]string{"dir/.nvmrc": "v20.11.0\n", "dir/package.json": `{"engines": {"node": ">=18"}}`},
+			version: "20.11.0",
+			ok:      true,
+		},
+		{
+			desc:    "package.json engines",
+			lang:    "node",
+			files:   map[string]string{"dir/package.json": `{"engines": {"node": ">=18"}}`},
+			version: ">=18",
+			ok:      true,
+		},
+		{
+			// A project without a version stops the search all the same.
+			desc:  "package.json without engines",
+			lang:  "node",
+			files: map[string]string{"dir/package.json": `{"name": "app"}`, ".nvmrc": "20\n"},
+			ok:    true,
+		},
+		{
+			desc:    "pyproject poetry",
+			lang:    "python",
+			files:   map[string]string{"dir/pyproject.toml": "[tool.poetry.dependencies]\npython = \"^3.11\"\n"},
+			version: "^3.11",
+			ok:      true,
+		},
+		{
+			desc:    "legacy rust-toolchain",
+			lang:    "rust",
+			files:   map[string]string{"dir/rust-toolchain": "nightly-2024-02-01\n"},
+			version: "nightly-2024-02-01",
+			ok:      true,
+		},
+		{
+			desc:    "legacy rust-toolchain in toml",
+			lang:    "rust",
+			files:   map[string]string{"dir/rust-toolchain": "[toolchain]\nchannel = \"stable\"\n"},
+			version: "stable",
+			ok:      true,
+		},
+	} {
+		root := t.TempDir()
+		dir := filepath.Join(root, "dir")
+		mkdirs(t, dir)
+		for name, data := range tc.files {
+			if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		version, ok := toolchains[tc.lang].find([]string{dir, root})
+		if version != tc.version || ok != tc.ok {
+			t.Errorf("%s: find() = %q, %v, expected %q, %v", tc.desc, version, ok, tc.version, tc.ok)
+		}
+	}
+}
+
+func TestLangSearchDirs(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	sub := filepath.Join(repo, "a", "b")
+	plain := filepath.Join(root, "plain", "a")
+	mkdirs(t, sub, filepath.Join(repo, ".git"), plain)
+
+	for _, tc := range []struct {
+		wd       string
+		expected []string
+	}{
+		{"", nil},
+		{repo, []string{repo}},
+		{sub + "/", []string{sub, filepath.Join(repo, "a"), repo}},
+		{plain, []string{plain}},
+	} {
+		if dirs := langSearchDirs(tc.wd); !reflect.DeepEqual(dirs, tc.expected) {
+			t.Errorf("langSearchDirs(%v) = %v, expected %v", tc.wd, dirs, tc.expected)
+		}
+	}
+}
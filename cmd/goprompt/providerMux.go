@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// providerMux reports the terminal multiplexer (tmux, screen, zellij) the
+// session runs in.
+type providerMux struct{}
+
+func init() {
+	registerProvider(providerMux{})
+}
+
+func (providerMux) Name() string {
+	return "mux"
+}
+
+func (providerMux) Detect(_ context.Context, q *queryEnv) bool {
+	return q.getenv("TMUX") != "" || q.getenv("STY") != "" || q.getenv("ZELLIJ_SESSION_NAME") != ""
+}
+
+func (providerMux) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	switch {
+	case q.getenv("TMUX") != "":
+		printPart(_partMuxKind, "tmux")
+
+		// Asking the server is the only way to get the names, it answers
+		// quickly as it does not need to start anything.
+		args := []string{"display-message", "-p"}
+		if pane := q.getenv("TMUX_PANE"); pane != "" {
+			args = append(args, "-t", pane)
+		}
+		args = append(args, "#S\t#I")
+
+		if out, err := q.stringExec(ctx, "tmux", args...); err == nil {
+			session, window, _ := strings.Cut(out, "\t")
+			printPart(_partMuxSession, session)
+			printPart(_partMuxWindow, window)
+		}
+
+	case q.getenv("STY") != "":
+		printPart(_partMuxKind, "screen")
+
+		// STY is <pid>.<session name>.
+		_, session, _ := strings.Cut(q.getenv("STY"), ".")
+		printPart(_partMuxSession, session)
+		if window := q.getenv("WINDOW"); window != "" {
+			printPart(_partMuxWindow, window)
+		}
+
+	case q.getenv("ZELLIJ_SESSION_NAME") != "":
+		printPart(_partMuxKind, "zellij")
+		printPart(_partMuxSession, q.getenv("ZELLIJ_SESSION_NAME"))
+	}
+
+	return nil
+}
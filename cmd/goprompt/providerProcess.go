@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// providerProcess walks the parent process chain to find the shell, its
+// parent application and any remote (ssh, mosh, et) server process.
+type providerProcess struct{}
+
+func init() {
+	registerProvider(providerProcess{})
+}
+
+func (providerProcess) Name() string {
+	return "process"
+}
+
+func (providerProcess) Detect(context.Context, *queryEnv) bool {
+	return true
+}
+
+// psEntry is a process in the parent chain of the query, Name and Cmdline
+// are only set when ok.
+type psEntry struct {
+	*process.Process
+	Name    string
+	Cmdline []string
+	ok      bool
+}
+
+// processChain returns the parents of the query process (q.Pid) up to init,
+// closest first. It is walked once per query and shared between providers.
+func (q *queryEnv) processChain(ctx context.Context) ([]psEntry, error) {
+	q.psOnce.Do(func() {
+		psRef, err := process.NewProcess(int32(q.Pid))
+		if err != nil {
+			q.psErr = err
+		}
+
+		for psRef != nil && psRef.Pid != 0 {
+			psParent, err := psRef.ParentWithContext(ctx)
+			if err != nil {
+				q.psErr = err
+				break
+			}
+
+			entry := psEntry{Process: psParent}
+			if entry.Name, err = psParent.NameWithContext(ctx); err == nil {
+				if entry.Cmdline, err = psParent.CmdlineSliceWithContext(ctx); err == nil {
+					entry.ok = true
+				}
+			}
+
+			q.psChain = append(q.psChain, entry)
+			psRef = psParent
+		}
+	})
+	return q.psChain, q.psErr
+}
+
+func (providerProcess) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	type list []interface{}
+	type dict map[string]interface{}
+
+	osName := runtime.GOOS
+
+	psChain, err := q.processChain(ctx)
+	if err != nil {
+		printPart("debug_ps_error", err.Error())
+	}
+
+	printPart(_partPidChainLength, len(psChain))
+
+	var pidRemote *psEntry
+	var pidChain list
+	for psIdx, ps := range psChain {
+		if !ps.ok {
+			continue
+		}
+		name, cmdline := ps.Name, ps.Cmdline
+
+		// Find if we are in a remote session.
+		if remoteTransport(name) != "" && pidRemote == nil {
+			pidRemote = &psChain[psIdx]
+		}
+
+		psIdxAdj := psIdx - q.PidParentSkip
+
+		pidExec := ""
+		if len(cmdline) > 0 {
+			pidExec = filepath.Base(cmdline[0])
+		}
+		pidApp := pidExec
+
+		if osName == "darwin" && len(cmdline) > 0 {
+			// Extract $SOME_LOCATION/$NAME.app/.../$EXEC_NAME from cmdline
+			parts := strings.Split(cmdline[0], "/")
+			for i := range parts[:len(parts)-1] {
+				if strings.HasSuffix(parts[i], ".app") {
+					pidApp = parts[i]
+					pidExec = parts[len(parts)-1]
+					break
+				}
+			}
+		}
+
+		pidChain = append(pidChain, dict{
+			"name":    name,
+			"pid":     ps.Pid,
+			"cmdline": cmdline,
+			"exec":    pidExec,
+			"app":     pidApp,
+		})
+
+		if psIdxAdj == 1 {
+			printPart(_partPidShell, ps.Pid)
+			printPart(_partPidShellExec, pidExec)
+			printPart(_partPidShellApp, pidApp)
+			printPart(_partPidShellArgs, name)
+		} else if psIdxAdj == 2 {
+			printPart(_partPidParent, ps.Pid)
+			printPart(_partPidParentExec, pidExec)
+			printPart(_partPidParentApp, pidApp)
+			printPart(_partPidParentArgs, name)
+		}
+	}
+
+	if pidRemote != nil {
+		pidShellRemoteExecName, _, _ := strings.Cut(pidRemote.Name, " ")
+		printPart(_partPidRemote, pidRemote.Pid)
+		printPart(_partPidRemoteExec, pidShellRemoteExecName)
+	}
+
+	if q.PidChain {
+		pidChainJson, _ := json.Marshal(pidChain)
+		printPart(_partPidChain, string(pidChainJson))
+	}
+
+	return nil
+}
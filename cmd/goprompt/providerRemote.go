@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// providerRemote reports whether the session is remote, over which transport
+// and from which client address.
+type providerRemote struct{}
+
+func init() {
+	registerProvider(providerRemote{})
+}
+
+func (providerRemote) Name() string {
+	return "remote"
+}
+
+func (providerRemote) Detect(context.Context, *queryEnv) bool {
+	return true
+}
+
+// remoteTransport returns the transport (ssh, mosh, et) served by the process
+// with the given name, or "" if it is not a remote session server. Clients
+// (ssh) and helpers (ssh-agent) do not count.
+func remoteTransport(name string) string {
+	name, _, _ = strings.Cut(name, " ")
+	name = strings.TrimSuffix(name, ":")
+
+	switch name {
+	case "sshd", "sshd-session", "sshd-auth":
+		return "ssh"
+	case "mosh-server":
+		return "mosh"
+	case "etserver", "etterminal":
+		return "et"
+	}
+	return ""
+}
+
+func (providerRemote) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	// The ssh variables are inherited through sudo (when kept) and tmux,
+	// which both break the process chain.
+	client := ""
+	if conn := strings.Fields(q.getenv("SSH_CONNECTION")); len(conn) > 0 {
+		client = conn[0]
+	} else if conn := strings.Fields(q.getenv("SSH_CLIENT")); len(conn) > 0 {
+		client = conn[0]
+	}
+
+	transport := ""
+	if client != "" || q.getenv("SSH_TTY") != "" {
+		transport = "ssh"
+	}
+
+	// mosh and et are started over ssh, so the chain tells them apart.
+	psChain, _ := q.processChain(ctx)
+	for _, ps := range psChain {
+		if !ps.ok {
+			continue
+		}
+		if psTransport := remoteTransport(ps.Name); psTransport != "" {
+			if transport == "" || psTransport != "ssh" {
+				transport = psTransport
+			}
+			break
+		}
+	}
+
+	if transport == "" {
+		return nil
+	}
+
+	printPart(_partRemoteTransport, transport)
+	if client != "" {
+		printPart(_partRemoteClient, client)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// providerSapling reports the state of a Sapling (sl) checkout.
+type providerSapling struct{}
+
+func init() {
+	registerProvider(providerSapling{})
+}
+
+func (providerSapling) Name() string {
+	return "sapling"
+}
+
+func (providerSapling) Detect(_ context.Context, q *queryEnv) bool {
+	if kind, _ := vcsFindRoot(q.Wd); kind == "hg" {
+		// Sapling also understands .hg checkouts, which are left to the hg
+		// provider unless Mercurial itself is missing (see vcsMarkers).
+		return false
+	}
+	// Whether this is a Sapling checkout (which may also be a git
+	// repository) is left for Collect to ask `sl root`, within the provider
+	// timeout.
+	_, err := exec.LookPath("sl")
+	return err == nil
+}
+
+func (providerSapling) CacheKey(q *queryEnv) string {
+	root, _ := findUp(q.Wd, ".sl")
+	return root
+}
+
+func (providerSapling) WatchSpec(_ *queryEnv, root string) watchSpec {
+	slDir := filepath.Join(root, ".sl")
+	return watchSpec{
+		Dirs:      []string{slDir},
+		Trees:     []string{root},
+		Skip:      []string{slDir},
+		GitIgnore: true,
+	}
+}
+
+// saplingTemplate prints the fields read by providerSapling.Collect for the
+// working copy parent, tab separated.
+//
+// The stack is the draft commits in line with ".", and the distance is
+// counted against the remote bookmarks built on the public base of ".".
+const saplingTemplate = `{rev}\t{node}\t{join(remotenames, "#")}\t{join(bookmarks, "#")}\t{activebookmark}\t{ifcontains(rev, revset("."), "@")}` +
+	`\t{revset("draft() & ::.")|count}` +
+	`\t{revset("draft() & (::. + .::)")|count}` +
+	`\t{revset("only(., remotenames())")|count}` +
+	`\t{revset("only(remotenames() & max(public() & ::.)::, .)")|count}` +
+	`\t{ifcontains(rev, revset("obsolete()"), "1", "0")}` +
+	`\t{revset("orphan() & (::. + .::)")|count}` +
+	`\n`
+
+func (providerSapling) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	if _, err := q.stringExec(ctx, "sl", "root"); err != nil {
+		return nil
+	}
+
+	subTasks := mkWgPool(ctx)
+	defer subTasks.Wait()
+
+	printPart(_partVcs, "sapling")
+
+	subTasks.Go(func(ctx context.Context) error {
+		revInfo, err := q.stringExec(ctx, "sl", "log", "-r", ".", "--template", saplingTemplate)
+		if err != nil {
+			return nil
+		}
+
+		info := strings.Split(revInfo, "\t")
+		if len(info) < 12 {
+			return nil
+		}
+
+		printPart(_partVcsSaplRev, info[0])
+		printPart(_partVcsSaplNode, info[1])
+		printPart(_partVcsSaplBookmarks, info[3])
+		if info[4] == "" {
+			printPart(_partVcsSaplBookmarkActive, "@")
+		} else {
+			printPart(_partVcsSaplBookmarkActive, info[4])
+		}
+		printPart(_partVcsSaplBookmarksRemote, info[2])
+
+		if stackLen := strInt(info[7]); stackLen > 0 {
+			printPart(_partVcsSaplStackPos, strInt(info[6]))
+			printPart(_partVcsSaplStackLen, stackLen)
+		}
+		printPart(_partVcsLogAhead, strInt(info[8]))
+		printPart(_partVcsLogBehind, strInt(info[9]))
+
+		printPart(_partVcsSaplObsolete, info[10])
+		printPart(_partVcsSaplOrphans, strInt(info[11]))
+
+		return nil
+	})
+
+	subTasks.Go(func(ctx context.Context) error {
+		saplStatus, err := q.stringExec(ctx, "sl", "status")
+		if err != nil {
+			return nil
+		}
+		if len(saplStatus) == 0 {
+			printPart(_partVcsDirty, 0)
+			return nil
+		}
+
+		var modified, added, removed, unknown int
+		for _, line := range strings.Split(saplStatus, "\n") {
+			if len(line) == 0 {
+				continue
+			}
+			switch line[0] {
+			case 'M':
+				modified++
+			case 'A':
+				added++
+			case 'R', '!':
+				removed++
+			case '?':
+				unknown++
+			}
+		}
+
+		printPart(_partVcsDirty, 1)
+		printPart(_partVcsSaplModified, modified)
+		printPart(_partVcsSaplAdded, added)
+		printPart(_partVcsSaplRemoved, removed)
+		printPart(_partVcsSaplUnknown, unknown)
+		return nil
+	})
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// providerSession reports the working directory, session user/host and the
+// duration of the previous command.
+type providerSession struct{}
+
+func init() {
+	registerProvider(providerSession{})
+}
+
+func (providerSession) Name() string {
+	return "session"
+}
+
+func (providerSession) Detect(context.Context, *queryEnv) bool {
+	return true
+}
+
+func (providerSession) Collect(_ context.Context, q *queryEnv, printPart partPrinter) error {
+	nowTS := time.Now()
+	homeDir := q.getenv("HOME")
+
+	if wd := q.Wd; wd != "" {
+		wdh := strings.Replace(wd, homeDir, "~", 1)
+
+		printPart(_partWorkDir, wdh)
+		printPart(_partWorkDirShort, trimPath(wdh))
+	}
+
+	sessionUser, err := user.Current()
+	if err == nil {
+		printPart(_partSessionUsername, sessionUser.Username)
+	}
+
+	sessionHostname, err := os.Hostname()
+	if err == nil {
+		printPart(_partSessionHostname, sessionHostname)
+	}
+
+	preexecTS := trim(q.PreexecTS)
+	if preexecTS != "0" {
+		if ts, err := strconv.Atoi(preexecTS); err == nil {
+			cmdTS := time.Unix(int64(ts), 0)
+			diff := nowTS.Sub(cmdTS).Round(time.Second)
+			if diff > 1 {
+				printPart(_partDuration, diff)
+			}
+		}
+	}
+
+	return nil
+}
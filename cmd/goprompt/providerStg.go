@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// providerStg reports the patch stack of a Stacked Git (stg) branch.
+type providerStg struct{}
+
+func init() {
+	registerProvider(providerStg{})
+}
+
+func (providerStg) Name() string {
+	return "stg"
+}
+
+func (providerStg) Detect(_ context.Context, q *queryEnv) bool {
+	if _, err := exec.LookPath("stg"); err != nil {
+		return false
+	}
+
+	// Skip running stg on branches it was never initialised on.
+	if repo := gitRepo(q); repo != nil {
+		head, err := repo.Head()
+		if err != nil || head.Detached() {
+			return false
+		}
+		_, err = repo.ResolveRef("refs/stacks/" + head.Branch())
+		return err == nil
+	}
+	return true
+}
+
+func (providerStg) CacheKey(q *queryEnv) string {
+	root, _ := findUp(q.Wd, ".git")
+	return root
+}
+
+func (providerStg) WatchSpec(_ *queryEnv, root string) watchSpec {
+	return gitWatchSpec(root)
+}
+
+// stgSeries is the parsed output of `stg series --all --description`.
+type stgSeries struct {
+	Applied   int
+	Unapplied int
+	Hidden    int
+	Top       string
+}
+
+func parseStgSeries(out string) stgSeries {
+	var s stgSeries
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+
+		// "<mark> <name> # <description>", where the mark is one of
+		// + (applied), > (top), - (unapplied) or ! (hidden).
+		fields := strings.Fields(line[1:])
+		if len(fields) == 0 {
+			continue
+		}
+		switch line[0] {
+		case '+':
+			s.Applied++
+		case '>':
+			s.Applied++
+			s.Top = fields[0]
+		case '-':
+			s.Unapplied++
+		case '!':
+			s.Hidden++
+		}
+	}
+	return s
+}
+
+func (providerStg) Collect(ctx context.Context, q *queryEnv, printPart partPrinter) error {
+	// A single series call lists all patches, which is enough for
+	// everything but the sync check below.
+	out, err := q.stringExec(ctx, "stg", "series", "--all", "--description")
+	if err != nil {
+		return nil
+	}
+	series := parseStgSeries(out)
+
+	printPart(_partVcsStg, "1")
+	printPart(_partVcsStgQlen, series.Applied+series.Unapplied)
+	printPart(_partVcsStgQpos, series.Applied)
+	printPart(_partVcsStgUnapplied, series.Unapplied)
+	printPart(_partVcsStgHidden, series.Hidden)
+
+	repo := gitRepo(q)
+	var branch string
+	if repo != nil {
+		if head, err := repo.Head(); err == nil {
+			branch = head.Branch()
+		}
+	} else {
+		branch, _ = q.stringExec(ctx, "stg", "branch")
+	}
+	if branch != "" {
+		printPart(_partVcsStgBranch, branch)
+	}
+
+	if series.Top == "" {
+		// Initialised, with no patches applied.
+		return nil
+	}
+	printPart(_partVcsStgTop, series.Top)
+
+	// The stack metadata is out of sync when HEAD moved without stg, e.g.
+	// after a plain `git commit`.
+	var headSHA, topSHA string
+	if repo != nil && branch != "" {
+		if head, err := repo.Head(); err == nil {
+			headSHA = head.OID
+		}
+		topSHA, _ = repo.ResolveRef("refs/patches/" + branch + "/" + series.Top)
+	}
+	if headSHA == "" || topSHA == "" {
+		headSHA, _ = q.stringExec(ctx, "stg", "id")
+		topSHA, _ = q.stringExec(ctx, "stg", "id", series.Top)
+	}
+
+	if headSHA != topSHA {
+		printPart(_partVcsStgDirty, 1)
+	} else {
+		printPart(_partVcsStgDirty, 0)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseStgSeries(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		out      string
+		expected stgSeries
+	}{
+		{
+			desc: "empty stack",
+			out:  "",
+		},
+		{
+			desc: "top applied",
+			out: "+ first   # add the first thing\n" +
+				"+ second  # \n" +
+				"> third   # fix - and + > ! in descriptions\n",
+			expected: stgSeries{Applied: 3, Top: "third"},
+		},
+		{
+			desc: "partially applied",
+			out: "+ first   # add the first thing\n" +
+				"> second  # second\n" +
+				"- third   # third\n" +
+				"- fourth  # fourth\n" +
+				"! hidden  # hidden\n",
+			expected: stgSeries{Applied: 2, Unapplied: 2, Hidden: 1, Top: "second"},
+		},
+		{
+			desc: "none applied",
+			out: "- first   # first\n" +
+				"- second  # second\n",
+			expected: stgSeries{Unapplied: 2},
+		},
+		{
+			desc:     "no descriptions",
+			out:      "+ first\r\n> second\r\n\r\n",
+			expected: stgSeries{Applied: 2, Top: "second"},
+		},
+	} {
+		if s := parseStgSeries(tc.out); s != tc.expected {
+			t.Errorf("%s: parseStgSeries() = %+v, expected %+v", tc.desc, s, tc.expected)
+		}
+	}
+}
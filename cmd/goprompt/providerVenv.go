@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// providerVenv reports the active Python virtualenv or conda environment,
+// without running python.
+type providerVenv struct{}
+
+func init() {
+	registerProvider(providerVenv{})
+}
+
+func (providerVenv) Name() string {
+	return "venv"
+}
+
+func (providerVenv) Detect(_ context.Context, q *queryEnv) bool {
+	return q.getenv("VIRTUAL_ENV") != "" || q.getenv("CONDA_DEFAULT_ENV") != ""
+}
+
+func (providerVenv) Collect(_ context.Context, q *queryEnv, printPart partPrinter) error {
+	// An activated virtualenv shadows the conda environment it may have been
+	// created from.
+	if venv := q.getenv("VIRTUAL_ENV"); venv != "" {
+		venvCfg := readPyvenvCfg(filepath.Join(venv, "pyvenv.cfg"))
+
+		name := strings.Trim(venvCfg["prompt"], `'"`)
+		if name == "" {
+			name = filepath.Base(venv)
+		}
+
+		// virtualenv writes version_info, the venv module version (or
+		// version_info since Python 3.11).
+		version := venvCfg["version"]
+		if version == "" {
+			version = pythonVersion(venvCfg["version_info"])
+		}
+
+		printPart(_partPyEnvKind, "venv")
+		printPart(_partPyEnv, name)
+		if version != "" {
+			printPart(_partPyEnvVersion, version)
+		}
+		return nil
+	}
+
+	printPart(_partPyEnvKind, "conda")
+	printPart(_partPyEnv, q.getenv("CONDA_DEFAULT_ENV"))
+	if version := condaPythonVersion(q.getenv("CONDA_PREFIX")); version != "" {
+		printPart(_partPyEnvVersion, version)
+	}
+	return nil
+}
+
+// readPyvenvCfg reads the `key = value` lines of a pyvenv.cfg file.
+func readPyvenvCfg(path string) map[string]string {
+	values := make(map[string]string)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// condaPythonVersion returns the version of the python package installed in
+// the conda environment, from its conda-meta/python-<version>-<build>.json
+// record.
+func condaPythonVersion(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+
+	records, _ := filepath.Glob(filepath.Join(prefix, "conda-meta", "python-[0-9]*.json"))
+	for _, record := range records {
+		name := strings.TrimPrefix(filepath.Base(record), "python-")
+		if version, _, ok := strings.Cut(name, "-"); ok {
+			return version
+		}
+	}
+	return ""
+}
+
+// pythonVersion trims a version_info (e.g. 3.12.1.final.0) to the version.
+func pythonVersion(versionInfo string) string {
+	parts := strings.Split(versionInfo, ".")
+	return strings.Join(parts[:intMin(len(parts), 3)], ".")
+}
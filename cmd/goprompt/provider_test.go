@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProvider is a Provider driven by the test, it prints "<name>_part" and
+// then waits for delay (or the context) before returning.
+type testProvider struct {
+	name   string
+	detect bool
+	delay  time.Duration
+}
+
+func (p testProvider) Name() string {
+	return p.name
+}
+
+func (p testProvider) Detect(context.Context, *queryEnv) bool {
+	return p.detect
+}
+
+func (p testProvider) Collect(ctx context.Context, _ *queryEnv, printPart partPrinter) error {
+	printPart(p.name+"_part", 1)
+	select {
+	case <-time.After(p.delay):
+		printPart(p.name+"_late", 1)
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// testParts records the parts printed by a provider.
+type testParts struct {
+	mu    sync.Mutex
+	parts map[string]interface{}
+}
+
+func (tp *testParts) printPart(name string, value interface{}) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.parts == nil {
+		tp.parts = make(map[string]interface{})
+	}
+	tp.parts[name] = value
+}
+
+func (tp *testParts) has(name string) bool {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	_, ok := tp.parts[name]
+	return ok
+}
+
+func TestRunProvider(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		p        testProvider
+		timeout  time.Duration
+		expected map[string]bool
+	}{
+		{
+			desc:    "completes",
+			p:       testProvider{name: "p", detect: true},
+			timeout: time.Second,
+			expected: map[string]bool{
+				"p_part": true, "p_late": true, "p_state": false,
+			},
+		},
+		{
+			desc: "no timeout",
+			p:    testProvider{name: "p", detect: true, delay: 10 * time.Millisecond},
+			expected: map[string]bool{
+				"p_part": true, "p_late": true, "p_state": false,
+			},
+		},
+		{
+			desc:    "cut off",
+			p:       testProvider{name: "p", detect: true, delay: time.Minute},
+			timeout: 10 * time.Millisecond,
+			expected: map[string]bool{
+				"p_part": true, "p_late": false, "p_state": true,
+			},
+		},
+		{
+			desc:    "not detected",
+			p:       testProvider{name: "p", detect: false, delay: time.Minute},
+			timeout: time.Nanosecond,
+			expected: map[string]bool{
+				"p_part": false, "p_state": false,
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var tp testParts
+			runProvider(context.Background(), &queryEnv{}, tc.p, tc.timeout, tp.printPart)
+			for name, expected := range tc.expected {
+				if tp.has(name) != expected {
+					t.Errorf("%s printed = %v, expected %v", name, !expected, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectProviders(t *testing.T) {
+	defer func(registered []Provider) { providers = registered }(providers)
+	providers = nil
+	for _, name := range []string{"a", "b", "c"} {
+		registerProvider(testProvider{name: name})
+	}
+
+	for _, tc := range []struct {
+		enable, disable []string
+		expected        string
+		err             bool
+	}{
+		{expected: "a,b,c"},
+		{enable: []string{"c", "a"}, expected: "a,c"},
+		{disable: []string{"b"}, expected: "a,c"},
+		{enable: []string{"a", "b"}, disable: []string{"b"}, expected: "a"},
+		{enable: []string{" a ", ""}, expected: "a"},
+		{enable: []string{"a", "d"}, err: true},
+		{disable: []string{"d"}, err: true},
+	} {
+		selected, err := selectProviders(tc.enable, tc.disable)
+		if tc.err {
+			if err == nil {
+				t.Errorf("selectProviders(%q, %q) did not fail", tc.enable, tc.disable)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("selectProviders(%q, %q) failed: %v", tc.enable, tc.disable, err)
+			continue
+		}
+
+		var names []string
+		for _, p := range selected {
+			names = append(names, p.Name())
+		}
+		if strings.Join(names, ",") != tc.expected {
+			t.Errorf("selectProviders(%q, %q) = %v, expected %v", tc.enable, tc.disable, names, tc.expected)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -15,7 +18,7 @@ import (
 // ----------------------------------------------------------------------------
 
 func timeFMT(ts time.Time) string {
-	return ts.Format("15:04:05 01/02/06")
+	return ts.Format(cfg.TimeFormat)
 }
 
 // ----------------------------------------------------------------------------
@@ -32,6 +35,7 @@ func (kv shellKV) String() string {
 // ----------------------------------------------------------------------------
 
 func shellKVStaggeredPrinter(
+	w io.Writer,
 	printCH <-chan shellKV,
 
 	dFirst time.Duration,
@@ -44,12 +48,14 @@ func shellKVStaggeredPrinter(
 			return
 		}
 		for _, p := range parts {
-			fmt.Println(p.String())
+			fmt.Fprintln(w, p.String())
 		}
 		if len(parts) > 0 {
-			fmt.Println()
+			fmt.Fprintln(w)
+		}
+		if f, ok := w.(*os.File); ok {
+			f.Sync()
 		}
-		os.Stdout.Sync()
 	}
 
 	timer := time.NewTimer(dFirst)
@@ -76,15 +82,18 @@ printLoop:
 
 // ----------------------------------------------------------------------------
 
-func stringExec(path string, args ...string) (string, error) {
-	ctx, ctxCancel := context.WithTimeout(bgctx, 10*time.Second)
+func (q *queryEnv) stringExec(ctx context.Context, path string, args ...string) (string, error) {
+	ctx, ctxCancel := context.WithTimeout(ctx, 10*time.Second)
 	defer ctxCancel()
 
 	out, err := shellout.New(ctx,
 		shellout.Args(path, args...),
-		shellout.EnvInherit(),
+		shellout.Dir(q.Wd),
+		shellout.EnvSet(q.Env),
 		shellout.EnvSet(map[string]string{
 			"GIT_OPTIONAL_LOCKS": "0",
+			// Ignore user aliases and output settings of hg and sl.
+			"HGPLAIN": "1",
 		}),
 	).RunString()
 
@@ -149,3 +158,97 @@ func strInt(s string) int {
 	r, _ := strconv.Atoi(s)
 	return r
 }
+
+// findUp walks up from dir looking for an entry called name and returns the
+// directory containing it.
+func findUp(dir, name string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+
+	dir = filepath.Clean(dir)
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			return dir, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// vcsMarkers are the entries marking the root of a checkout, in order of
+// precedence when several of them are in the same directory (e.g. a jj
+// repository colocated with git). Markers with a bin are skipped when it is
+// not installed, as the checkout is then only usable through the next one.
+var vcsMarkers = []struct {
+	kind string
+	name string
+	bin  string
+}{
+	{"jj", ".jj", "jj"},
+	{"sapling", ".sl", ""},
+	{"hg", ".hg", "hg"},
+	{"git", ".git", ""},
+}
+
+// vcsFindRoot walks up from dir to the closest checkout root and returns the
+// kind of VCS owning it (as named in vcsMarkers) and the root directory.
+func vcsFindRoot(dir string) (kind string, root string) {
+	if dir == "" {
+		return "", ""
+	}
+
+	dir = filepath.Clean(dir)
+	for {
+		for _, marker := range vcsMarkers {
+			if _, err := os.Lstat(filepath.Join(dir, marker.name)); err != nil {
+				continue
+			}
+			if marker.bin != "" {
+				if _, err := exec.LookPath(marker.bin); err != nil {
+					continue
+				}
+			}
+			return marker.kind, dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// readINI reads an INI style file (as used by the aws and gcloud CLIs) into
+// section -> key -> value. Keys outside of any section are under "".
+func readINI(path string) (map[string]map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := map[string]map[string]string{"": {}}
+	section := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if sections[section] == nil {
+				sections[section] = make(map[string]string)
+			}
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			sections[section][strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return sections, nil
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSpec lists the directories whose changes invalidate cached results.
+type watchSpec struct {
+	Dirs  []string // watched non-recursively
+	Trees []string // watched recursively
+	Skip  []string // directories excluded when walking Trees
+
+	// GitIgnore excludes the directories ignored by .gitignore files when
+	// walking Trees, see parseGitIgnore.
+	GitIgnore bool
+}
+
+func (s watchSpec) empty() bool {
+	return len(s.Dirs) == 0 && len(s.Trees) == 0
+}
+
+// watchableProvider is a cacheableProvider whose cached results stay valid
+// until something changes under the directories described by WatchSpec.
+type watchableProvider interface {
+	cacheableProvider
+
+	// WatchSpec is called with the non empty result of CacheKey.
+	WatchSpec(q *queryEnv, key string) watchSpec
+}
+
+// fsWatcher tracks filesystem changes under watched roots and counts them in
+// a per root generation, which cache entries use to tell if they are stale.
+//
+// Roots are shared by the cache entries using them and released with the last
+// one, directories watched by several roots are only watched once.
+type fsWatcher struct {
+	w       *fsnotify.Watcher
+	maxDirs int
+
+	mu      sync.Mutex
+	watched map[string]int // directory -> number of roots watching it
+	roots   map[string]*fsWatchRoot
+	// Keys whose directories did not fit, they are not watched again for
+	// fsWatchRetry.
+	failed map[string]time.Time
+}
+
+const fsWatchRetry = time.Minute
+
+type fsWatchRoot struct {
+	key   string
+	paths []string
+	skip  []string
+
+	gitIgnore bool
+	ignore    map[string][]gitIgnorePattern // directory -> its .gitignore
+
+	refs int
+	dirs map[string]bool
+
+	gen uint64
+	// Changes may go unnoticed until the directories are set up (ready) and
+	// when some of them could not be watched (missed).
+	ready    bool
+	missed   bool
+	released bool
+}
+
+func (r *fsWatchRoot) complete() bool {
+	return r.ready && !r.missed && !r.released
+}
+
+// newFSWatcher returns nil if watches are not available, in which case the
+// cache falls back to time based expiry.
+func newFSWatcher(maxDirs int) *fsWatcher {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		debugLog("watch: unavailable: " + err.Error())
+		return nil
+	}
+
+	fw := &fsWatcher{
+		w:       w,
+		maxDirs: maxDirs,
+		watched: make(map[string]int),
+		roots:   make(map[string]*fsWatchRoot),
+		failed:  make(map[string]time.Time),
+	}
+	go fw.loop()
+	return fw
+}
+
+func (fw *fsWatcher) Close() error {
+	return fw.w.Close()
+}
+
+// watch returns the root watching spec for key and its current generation,
+// or nil if spec is empty or key recently failed to fit. Each call holds a reference to the root until it is
+// given back with release.
+//
+// The directories are walked in the background, as a working tree can take a
+// while, and the root is incomplete until then.
+func (fw *fsWatcher) watch(key string, spec watchSpec) (*fsWatchRoot, uint64) {
+	if fw == nil || spec.empty() {
+		return nil, 0
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if r, ok := fw.roots[key]; ok {
+		r.refs++
+		return r, r.gen
+	}
+	if t, ok := fw.failed[key]; ok {
+		if time.Since(t) < fsWatchRetry {
+			return nil, 0
+		}
+		delete(fw.failed, key)
+	}
+
+	r := &fsWatchRoot{
+		key:       key,
+		skip:      spec.Skip,
+		gitIgnore: spec.GitIgnore,
+		ignore:    make(map[string][]gitIgnorePattern),
+		refs:      1,
+		dirs:      make(map[string]bool),
+	}
+	r.paths = append(r.paths, spec.Dirs...)
+	r.paths = append(r.paths, spec.Trees...)
+	fw.roots[key] = r
+
+	go fw.setup(r, spec)
+	return r, r.gen
+}
+
+// setup adds the watches of a new root.
+func (fw *fsWatcher) setup(r *fsWatchRoot, spec watchSpec) {
+	complete := true
+	for _, dir := range spec.Dirs {
+		if !fw.addDir(r, dir) {
+			complete = false
+		}
+	}
+	for _, tree := range spec.Trees {
+		if !fw.addTree(r, tree) {
+			complete = false
+		}
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if !complete {
+		debugLog("watch: incomplete watch for " + r.key)
+		fw.drop(r)
+		fw.failed[r.key] = time.Now()
+	}
+	r.ready = true
+	// Results collected during setup may have missed changes in directories
+	// that were not watched yet.
+	r.gen++
+}
+
+// generation returns the current generation of r, for a reference to r that
+// is kept across cache entries.
+func (fw *fsWatcher) generation(r *fsWatchRoot) uint64 {
+	if fw == nil || r == nil {
+		return 0
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return r.gen
+}
+
+// release gives back a reference returned by watch, the watches of r are
+// removed with the last one.
+func (fw *fsWatcher) release(r *fsWatchRoot) {
+	if fw == nil || r == nil {
+		return
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	r.refs--
+	if r.refs > 0 {
+		return
+	}
+	r.released = true
+	if fw.roots[r.key] == r {
+		delete(fw.roots, r.key)
+	}
+	for dir := range r.dirs {
+		fw.removeDir(r, dir)
+	}
+}
+
+// drop gives up on watching r, which is left to the references still held
+// and never complete again, fw.mu must be held.
+//
+// The watches are removed right away rather than with the last reference,
+// as a root that is missing some directories is of no use but counts
+// against maxDirs for the others.
+func (fw *fsWatcher) drop(r *fsWatchRoot) {
+	r.missed = true
+	if fw.roots[r.key] == r {
+		delete(fw.roots, r.key)
+	}
+	for dir := range r.dirs {
+		fw.removeDir(r, dir)
+	}
+}
+
+// usable reports if r can still become complete, a reference to a root that
+// is not is better released than kept across cache entries.
+func (fw *fsWatcher) usable(r *fsWatchRoot) bool {
+	if fw == nil || r == nil {
+		return false
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return !r.missed && !r.released
+}
+
+// changed reports if anything changed under r since generation gen. The
+// result is only meaningful if watched is true.
+func (fw *fsWatcher) changed(r *fsWatchRoot, gen uint64) (changed bool, watched bool) {
+	if fw == nil || r == nil {
+		return false, false
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return r.gen != gen, r.complete()
+}
+
+// addDir watches dir for r, it takes the lock itself as it is called while
+// walking trees.
+func (fw *fsWatcher) addDir(r *fsWatchRoot, dir string) bool {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if r.released || r.missed {
+		return false
+	}
+	if r.dirs[dir] {
+		return true
+	}
+	if fw.watched[dir] == 0 {
+		if len(fw.watched) >= fw.maxDirs {
+			return false
+		}
+		if err := fw.w.Add(dir); err != nil {
+			return false
+		}
+	}
+	fw.watched[dir]++
+	r.dirs[dir] = true
+	return true
+}
+
+// removeDir stops watching dir for r, fw.mu must be held.
+func (fw *fsWatcher) removeDir(r *fsWatchRoot, dir string) {
+	if !r.dirs[dir] {
+		return
+	}
+	delete(r.dirs, dir)
+
+	fw.watched[dir]--
+	if fw.watched[dir] > 0 {
+		return
+	}
+	delete(fw.watched, dir)
+	// Fails for directories that are gone, whose watch the kernel already
+	// dropped.
+	fw.w.Remove(dir)
+}
+
+func (fw *fsWatcher) addTree(r *fsWatchRoot, tree string) bool {
+	complete := true
+	filepath.WalkDir(tree, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			complete = false
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if r.skips(path) || fw.ignored(r, path) {
+			return filepath.SkipDir
+		}
+		if !fw.addDir(r, path) {
+			complete = false
+			return filepath.SkipAll
+		}
+		if r.gitIgnore {
+			fw.loadIgnore(r, path)
+		}
+		return nil
+	})
+	return complete
+}
+
+// loadIgnore reads the .gitignore file of dir for r.
+func (fw *fsWatcher) loadIgnore(r *fsWatchRoot, dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	patterns := parseGitIgnore(string(data))
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	r.ignore[dir] = patterns
+}
+
+// ignored reports if path is excluded by the .gitignore file of one of the
+// directories above it.
+func (fw *fsWatcher) ignored(r *fsWatchRoot, path string) bool {
+	if !r.gitIgnore {
+		return false
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if rel, err := filepath.Rel(dir, path); err == nil && gitIgnoreMatch(r.ignore[dir], filepath.ToSlash(rel)) {
+			return true
+		}
+		if filepath.Dir(dir) == dir {
+			return false
+		}
+	}
+}
+
+func (r *fsWatchRoot) skips(path string) bool {
+	for _, skip := range r.skip {
+		if path == skip {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fsWatchRoot) contains(path string) bool {
+	for _, p := range r.paths {
+		if pathWithin(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func (fw *fsWatcher) loop() {
+	for {
+		select {
+		case ev, ok := <-fw.w.Events:
+			if !ok {
+				return
+			}
+			fw.handleEvent(ev)
+
+		case err, ok := <-fw.w.Errors:
+			if !ok {
+				return
+			}
+			// Events might have been dropped (e.g. queue overflow), so
+			// nothing cached can be trusted anymore.
+			debugLog("watch: " + err.Error())
+			fw.mu.Lock()
+			for _, r := range fw.roots {
+				r.gen++
+			}
+			fw.mu.Unlock()
+		}
+	}
+}
+
+func (fw *fsWatcher) handleEvent(ev fsnotify.Event) {
+	fw.mu.Lock()
+
+	var created []*fsWatchRoot
+	for _, r := range fw.roots {
+		if !r.contains(ev.Name) {
+			continue
+		}
+		r.gen++
+
+		// The watch of a removed directory is dropped by the kernel, and
+		// that of a moved one by fsnotify, which leaves the directories
+		// below a moved one watched under paths that no longer exist.
+		if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+			for dir := range r.dirs {
+				if pathWithin(dir, ev.Name) {
+					fw.removeDir(r, dir)
+				}
+			}
+		}
+
+		// Directories that are no longer ignored would go unwatched.
+		if r.gitIgnore && filepath.Base(ev.Name) == ".gitignore" {
+			debugLog("watch: .gitignore changed for " + r.key)
+			fw.drop(r)
+			continue
+		}
+
+		if ev.Has(fsnotify.Create) {
+			created = append(created, r)
+		}
+	}
+	fw.mu.Unlock()
+
+	// Keep following newly created directories, which may be whole trees
+	// moved in, without holding up queries.
+	if len(created) == 0 {
+		return
+	}
+	if st, err := os.Lstat(ev.Name); err != nil || !st.IsDir() {
+		return
+	}
+	for _, r := range created {
+		if !fw.addTree(r, ev.Name) {
+			fw.mu.Lock()
+			fw.drop(r)
+			fw.failed[r.key] = time.Now()
+			fw.mu.Unlock()
+		}
+	}
+}
+
+// gitIgnorePattern is a .gitignore pattern matched against the path of a
+// directory relative to the .gitignore file (anchored) or its name.
+type gitIgnorePattern struct {
+	glob     string
+	anchored bool
+}
+
+// parseGitIgnore reads the subset of .gitignore patterns that can be matched
+// against directory names with path.Match.
+//
+// Patterns that do not fit are left out, as is the whole file if it
+// re-includes anything, so that no directory git looks at is skipped. This
+// still skips files that are tracked despite being ignored.
+func parseGitIgnore(data string) []gitIgnorePattern {
+	var patterns []gitIgnorePattern
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			return nil
+		}
+		if strings.Contains(line, "**") || strings.Contains(line, "\\") {
+			continue
+		}
+
+		glob := strings.TrimSuffix(line, "/")
+		anchored := strings.Contains(glob, "/")
+		glob = strings.TrimPrefix(glob, "/")
+		if glob == "" {
+			continue
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			continue
+		}
+		patterns = append(patterns, gitIgnorePattern{glob, anchored})
+	}
+	return patterns
+}
+
+func gitIgnoreMatch(patterns []gitIgnorePattern, rel string) bool {
+	for _, p := range patterns {
+		name := rel
+		if !p.anchored {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(p.glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
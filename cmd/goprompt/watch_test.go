@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestWatcher(t *testing.T, maxDirs int) *fsWatcher {
+	t.Helper()
+	fw := newFSWatcher(maxDirs)
+	if fw == nil {
+		t.Skip("filesystem watches are not available")
+	}
+	t.Cleanup(func() { fw.Close() })
+	return fw
+}
+
+// waitFor polls cond, watch events and setup are asynchronous.
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", desc)
+}
+
+func (fw *fsWatcher) watchedDirs() map[string]int {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	dirs := make(map[string]int)
+	for dir, n := range fw.watched {
+		dirs[dir] = n
+	}
+	return dirs
+}
+
+func mkdirs(t *testing.T, dirs ...string) {
+	t.Helper()
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFSWatcherTree(t *testing.T) {
+	root := t.TempDir()
+	mkdirs(t, filepath.Join(root, "a", "b", "c"), filepath.Join(root, ".git"))
+
+	fw := newTestWatcher(t, 100)
+	r, gen := fw.watch("repo", watchSpec{Trees: []string{root}, Skip: []string{filepath.Join(root, ".git")}})
+	if _, watched := fw.changed(r, gen); watched {
+		t.Errorf("watched before the setup")
+	}
+	waitFor(t, "setup", func() bool {
+		_, watched := fw.changed(r, 0)
+		return watched
+	})
+	if changed, _ := fw.changed(r, gen); !changed {
+		t.Errorf("results collected during the setup are not stale")
+	}
+	if n := len(fw.watchedDirs()); n != 4 {
+		t.Errorf("%d directories watched, expected 4: %v", n, fw.watchedDirs())
+	}
+
+	gen = fw.generation(r)
+	if err := os.WriteFile(filepath.Join(root, "a", "b", "c", "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "change", func() bool {
+		changed, _ := fw.changed(r, gen)
+		return changed
+	})
+
+	// The moved tree is watched under its new path only.
+	if err := os.Rename(filepath.Join(root, "a"), filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "rename", func() bool {
+		dirs := fw.watchedDirs()
+		return len(dirs) == 4 && dirs[filepath.Join(root, "moved", "b", "c")] == 1
+	})
+
+	if err := os.RemoveAll(filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "removal", func() bool {
+		return len(fw.watchedDirs()) == 1
+	})
+
+	fw.release(r)
+	if dirs := fw.watchedDirs(); len(dirs) != 0 || len(fw.roots) != 0 {
+		t.Errorf("released root still watched: %v", dirs)
+	}
+}
+
+func TestFSWatcherShared(t *testing.T) {
+	root := t.TempDir()
+	mkdirs(t, filepath.Join(root, "repo", "sub"))
+	repo := filepath.Join(root, "repo")
+
+	fw := newTestWatcher(t, 100)
+	r1, _ := fw.watch("repo", watchSpec{Trees: []string{repo}})
+	r2, _ := fw.watch("repo", watchSpec{Trees: []string{repo}})
+	if r1 != r2 {
+		t.Fatalf("watch() did not share the root")
+	}
+	// A nested root watches some directories of the first one again.
+	nested, _ := fw.watch("nested", watchSpec{Dirs: []string{filepath.Join(repo, "sub")}})
+	waitFor(t, "setup", func() bool {
+		_, watched1 := fw.changed(r1, 0)
+		_, watched2 := fw.changed(nested, 0)
+		return watched1 && watched2
+	})
+	if n := fw.watchedDirs()[filepath.Join(repo, "sub")]; n != 2 {
+		t.Errorf("shared directory counted %d times, expected 2", n)
+	}
+
+	fw.release(r1)
+	if _, watched := fw.changed(r2, 0); !watched {
+		t.Errorf("root released while still referenced")
+	}
+	fw.release(r2)
+	if _, watched := fw.changed(r2, 0); watched {
+		t.Errorf("released root still watched")
+	}
+	if dirs := fw.watchedDirs(); len(dirs) != 1 || dirs[filepath.Join(repo, "sub")] != 1 {
+		t.Errorf("watched after release = %v, expected the nested root only", dirs)
+	}
+}
+
+func TestFSWatcherMaxDirs(t *testing.T) {
+	root := t.TempDir()
+	mkdirs(t, filepath.Join(root, "big", "a", "b", "c"), filepath.Join(root, "small", "a"))
+
+	fw := newTestWatcher(t, 3)
+	big, _ := fw.watch("big", watchSpec{Trees: []string{filepath.Join(root, "big")}})
+	waitFor(t, "setup", func() bool {
+		fw.mu.Lock()
+		defer fw.mu.Unlock()
+		return big.ready
+	})
+	if _, watched := fw.changed(big, 0); watched {
+		t.Errorf("root over the limit is watched")
+	}
+	if dirs := fw.watchedDirs(); len(dirs) != 0 {
+		t.Errorf("root over the limit kept its watches: %v", dirs)
+	}
+	if fw.usable(big) {
+		t.Errorf("root over the limit is usable")
+	}
+	if r, _ := fw.watch("big", watchSpec{Trees: []string{filepath.Join(root, "big")}}); r != nil {
+		t.Errorf("root over the limit watched again right away")
+	}
+
+	// The limit is not used up by the root that did not fit, which is
+	// still referenced.
+	small, _ := fw.watch("small", watchSpec{Trees: []string{filepath.Join(root, "small")}})
+	waitFor(t, "setup", func() bool {
+		_, watched := fw.changed(small, 0)
+		return watched
+	})
+
+	fw.release(big)
+	fw.release(small)
+	if dirs := fw.watchedDirs(); len(dirs) != 0 || len(fw.roots) != 0 {
+		t.Errorf("released roots still watched: %v", dirs)
+	}
+}
+
+func TestFSWatcherGitIgnore(t *testing.T) {
+	root := t.TempDir()
+	mkdirs(t,
+		filepath.Join(root, "node_modules", "pkg"),
+		filepath.Join(root, "build"),
+		filepath.Join(root, "dist"),
+		filepath.Join(root, "src", "dist"),
+		filepath.Join(root, "src", "gen.out"),
+		filepath.Join(root, "vendor", "keep"),
+		filepath.Join(root, "vendor", "drop"),
+	)
+	for path, data := range map[string]string{
+		".gitignore":        "# deps\nnode_modules\nbuild/\n/dist\n*.out\n**/logs\n",
+		"vendor/.gitignore": "*\n!keep\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, path), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fw := newTestWatcher(t, 100)
+	r, _ := fw.watch("repo", watchSpec{Trees: []string{root}, GitIgnore: true})
+	waitFor(t, "setup", func() bool {
+		_, watched := fw.changed(r, 0)
+		return watched
+	})
+
+	expected := []string{"", "src", "src/dist", "vendor", "vendor/keep", "vendor/drop"}
+	dirs := fw.watchedDirs()
+	for _, dir := range expected {
+		if dirs[filepath.Join(root, dir)] != 1 {
+			t.Errorf("%q not watched", dir)
+		}
+	}
+	if len(dirs) != len(expected) {
+		t.Errorf("watched %v, expected %v", dirs, expected)
+	}
+
+	// Ignored directories created later are skipped as well.
+	mkdirs(t, filepath.Join(root, "src", "build"), filepath.Join(root, "src", "lib"))
+	waitFor(t, "create", func() bool {
+		return fw.watchedDirs()[filepath.Join(root, "src", "lib")] == 1
+	})
+	if fw.watchedDirs()[filepath.Join(root, "src", "build")] != 0 {
+		t.Errorf("created ignored directory watched")
+	}
+
+	// Directories may no longer be ignored, so the root is given up.
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, ".gitignore change", func() bool {
+		return !fw.usable(r)
+	})
+}
+
+// testWatchProvider is a testCacheProvider watching dir.
+type testWatchProvider struct {
+	testCacheProvider
+	dir string
+}
+
+func (p testWatchProvider) WatchSpec(*queryEnv, string) watchSpec {
+	return watchSpec{Dirs: []string{p.dir}}
+}
+
+func TestProviderCacheWatched(t *testing.T) {
+	dir := t.TempDir()
+	fw := newTestWatcher(t, 100)
+
+	calls := new(int32)
+	// With a ttl this short only watched entries are ever fresh.
+	cache := newProviderCache(time.Nanosecond, fw)
+	cp := cache.wrap(testWatchProvider{testCacheProvider{key: "repo", calls: calls}, dir})
+
+	collectCached(t, cp)
+	fw.mu.Lock()
+	r := fw.roots["repo"]
+	fw.mu.Unlock()
+	waitFor(t, "setup", func() bool {
+		_, watched := fw.changed(r, 0)
+		return watched
+	})
+
+	// Collected again once as the first result predates the setup, served
+	// from the cache afterwards.
+	for i := 0; i < 3; i++ {
+		if got := collectCached(t, cp); got != int32(2) {
+			t.Fatalf("collection %d printed %v, expected 2", i, got)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "change", func() bool {
+		return collectCached(t, cp) != int32(2)
+	})
+
+	// Replaced entries kept the one watch.
+	fw.mu.Lock()
+	refs := r.refs
+	fw.mu.Unlock()
+	if refs != 1 {
+		t.Errorf("root referenced %d times, expected 1", refs)
+	}
+
+	// Evicted by a query for another key once stale.
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := cache.wrap(testCacheProvider{key: "other", calls: new(int32)})
+	waitFor(t, "eviction", func() bool {
+		other.Collect(context.Background(), &queryEnv{}, func(string, interface{}) {})
+		return len(fw.watchedDirs()) == 0
+	})
+}
+
+func TestProviderCacheWatchDropped(t *testing.T) {
+	dir := t.TempDir()
+	fw := newTestWatcher(t, 0)
+
+	cache := newProviderCache(time.Nanosecond, fw)
+	cp := cache.wrap(testWatchProvider{testCacheProvider{key: "repo", calls: new(int32)}, dir})
+
+	collectCached(t, cp)
+	cache.mu.Lock()
+	r := cache.entries["cached\x00repo"].watchRoot
+	cache.mu.Unlock()
+	waitFor(t, "setup", func() bool {
+		return !fw.usable(r)
+	})
+
+	// The entry replacing the stale one releases the dropped root rather
+	// than keeping it.
+	collectCached(t, cp)
+	fw.mu.Lock()
+	refs := r.refs
+	fw.mu.Unlock()
+	if refs != 0 {
+		t.Errorf("dropped root referenced %d times, expected 0", refs)
+	}
+}
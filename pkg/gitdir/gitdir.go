@@ -0,0 +1,463 @@
+// Package gitdir reads repository state (HEAD, refs, ...) directly from the
+// git directory, without running git.
+//
+// It only understands the plain files layout (loose refs, packed-refs and
+// loose tag objects), callers are expected to fall back to running git when
+// it returns an error.
+package gitdir
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrNotFound = errors.New("gitdir: not a git repository")
+
+type Repo struct {
+	// WorkTree is the top level directory of the checkout, it is empty for
+	// a bare repository or when looking from inside the git dir.
+	WorkTree string
+	// GitDir holds the per worktree state (HEAD, index, ...).
+	GitDir string
+	// CommonDir holds the state shared between worktrees (refs, objects,
+	// ...), it is the same as GitDir unless this is a linked worktree.
+	CommonDir string
+	// Bare is set for bare repositories (core.bare).
+	Bare bool
+}
+
+// Find walks up from dir to the first directory containing a `.git` entry,
+// or that is a git dir itself, and returns the repository it belongs to.
+func Find(dir string) (*Repo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if isGitDir(dir) {
+			r, err := Open("", dir)
+			if err != nil {
+				return nil, err
+			}
+			r.Bare = r.CommonDir == r.GitDir && readCoreBare(r.CommonDir)
+			return r, nil
+		}
+
+		dotGit := filepath.Join(dir, ".git")
+		if st, err := os.Stat(dotGit); err == nil {
+			gitDir := dotGit
+			if !st.IsDir() {
+				if gitDir, err = readGitFile(dotGit); err != nil {
+					return nil, err
+				}
+			}
+			return Open(dir, gitDir)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// Open returns the repository with the given work tree and git dir.
+func Open(workTree, gitDir string) (*Repo, error) {
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); err != nil {
+		return nil, fmt.Errorf("gitdir: %v: %w", gitDir, ErrNotFound)
+	}
+
+	r := &Repo{
+		WorkTree:  workTree,
+		GitDir:    gitDir,
+		CommonDir: gitDir,
+	}
+
+	if commonDirB, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(commonDirB))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		r.CommonDir = filepath.Clean(commonDir)
+	}
+
+	return r, nil
+}
+
+// isGitDir reports if dir looks like a git dir, using the same heuristic as
+// git: a HEAD file next to objects and refs (or a commondir pointing to
+// them).
+func isGitDir(dir string) bool {
+	if st, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil || st.IsDir() {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(dir, "commondir")); err == nil {
+		return true
+	}
+	for _, name := range []string{"objects", "refs"} {
+		if st, err := os.Stat(filepath.Join(dir, name)); err != nil || !st.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// readCoreBare reads core.bare from the repository config.
+func readCoreBare(gitDir string) bool {
+	f, err := os.Open(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] \t"))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && section == "core" && strings.EqualFold(strings.TrimSpace(key), "bare") {
+			return strings.EqualFold(strings.TrimSpace(value), "true")
+		}
+	}
+	return false
+}
+
+// LinkedWorktree returns the name of the linked worktree (as created by
+// `git worktree add`), or "" for the main worktree.
+func (r *Repo) LinkedWorktree() string {
+	if r.CommonDir == r.GitDir {
+		return ""
+	}
+	return filepath.Base(r.GitDir)
+}
+
+// Superproject returns the work tree of the repository this one is a
+// submodule of, or "" when it is not a submodule.
+func (r *Repo) Superproject() string {
+	if r.WorkTree == "" {
+		return ""
+	}
+
+	super, err := Find(filepath.Dir(r.WorkTree))
+	if err != nil || super.WorkTree == "" {
+		return ""
+	}
+
+	// Absorbed submodules keep their git dir in the superproject.
+	modulesDir := filepath.Join(super.CommonDir, "modules") + string(filepath.Separator)
+	if strings.HasPrefix(r.CommonDir, modulesDir) {
+		return super.WorkTree
+	}
+
+	// Otherwise the path has to be listed in .gitmodules.
+	rel, err := filepath.Rel(super.WorkTree, r.WorkTree)
+	if err != nil {
+		return ""
+	}
+	b, err := os.ReadFile(filepath.Join(super.WorkTree, ".gitmodules"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(key) == "path" && strings.TrimSpace(value) == filepath.ToSlash(rel) {
+			return super.WorkTree
+		}
+	}
+	return ""
+}
+
+// readGitFile reads a `.git` file (as used by worktrees and submodules),
+// which points to the actual git dir.
+func readGitFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("gitdir: malformed %v", path)
+	}
+
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+// Head is the state of HEAD.
+type Head struct {
+	// Ref is the ref HEAD points to (e.g. refs/heads/main), empty when HEAD
+	// is detached.
+	Ref string
+	// OID is the commit checked out, empty on an unborn branch.
+	OID string
+}
+
+func (h Head) Detached() bool {
+	return h.Ref == ""
+}
+
+// Branch returns the short name of the checked out branch.
+func (h Head) Branch() string {
+	if name, ok := strings.CutPrefix(h.Ref, "refs/heads/"); ok {
+		return name
+	}
+	return h.Ref
+}
+
+func (r *Repo) Head() (Head, error) {
+	value, err := r.readRef("HEAD")
+	if err != nil {
+		return Head{}, err
+	}
+
+	target, ok := strings.CutPrefix(value, "ref: ")
+	if !ok {
+		return Head{OID: value}, nil
+	}
+
+	h := Head{Ref: strings.TrimSpace(target)}
+	h.OID, err = r.ResolveRef(h.Ref)
+	if errors.Is(err, ErrRefNotFound) {
+		// Unborn branch.
+		return h, nil
+	}
+	return h, err
+}
+
+var ErrRefNotFound = errors.New("gitdir: ref not found")
+
+// ResolveRef returns the object id the named ref (e.g. refs/heads/main)
+// points to, following symbolic refs.
+func (r *Repo) ResolveRef(name string) (string, error) {
+	for depth := 0; depth < 5; depth++ {
+		value, err := r.readRef(name)
+		if err != nil {
+			return "", err
+		}
+
+		target, ok := strings.CutPrefix(value, "ref: ")
+		if !ok {
+			return value, nil
+		}
+		name = strings.TrimSpace(target)
+	}
+	return "", fmt.Errorf("gitdir: too many levels of symbolic refs resolving %v", name)
+}
+
+// readRef returns the raw content of a loose or packed ref.
+func (r *Repo) readRef(name string) (string, error) {
+	dirs := []string{r.GitDir}
+	if r.CommonDir != r.GitDir {
+		dirs = append(dirs, r.CommonDir)
+	}
+
+	for _, dir := range dirs {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil {
+			return strings.TrimSpace(string(b)), nil
+		}
+	}
+
+	packed, err := r.PackedRefs()
+	if err != nil {
+		return "", err
+	}
+	if oid, ok := packed[name]; ok {
+		return oid, nil
+	}
+	return "", fmt.Errorf("%w: %v", ErrRefNotFound, name)
+}
+
+// PackedRefs returns the refs from packed-refs. Peeled values of annotated
+// tags are returned under "<ref>^{}".
+func (r *Repo) PackedRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+
+	f, err := os.Open(filepath.Join(r.CommonDir, "packed-refs"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return refs, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	lastRef := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if line[0] == '^' {
+			if lastRef != "" {
+				refs[lastRef+"^{}"] = line[1:]
+			}
+			continue
+		}
+
+		oid, name, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		refs[name] = oid
+		lastRef = name
+	}
+
+	return refs, scanner.Err()
+}
+
+// TagsAt returns the sorted names (e.g. v1.0.0) of the tags pointing at the
+// commit oid.
+//
+// Annotated tags are peeled using packed-refs or the loose tag object, ok is
+// false when a tag object is packed and the caller has to ask git instead.
+func (r *Repo) TagsAt(oid string) (tags []string, ok bool, err error) {
+	packed, err := r.PackedRefs()
+	if err != nil {
+		return nil, false, err
+	}
+
+	found := make(map[string]bool)
+	for name, value := range packed {
+		tag, isTag := strings.CutPrefix(name, "refs/tags/")
+		if !isTag || strings.HasSuffix(tag, "^{}") {
+			continue
+		}
+		if peeled, isPeeled := packed[name+"^{}"]; isPeeled {
+			value = peeled
+		}
+		if value == oid {
+			found[tag] = true
+		}
+	}
+
+	ok = true
+	tagsDir := filepath.Join(r.CommonDir, "refs", "tags")
+	err = filepath.WalkDir(tagsDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(tagsDir, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		// Loose refs take precedence over packed ones.
+		delete(found, name)
+
+		value := strings.TrimSpace(string(b))
+		if value == oid {
+			found[name] = true
+			return nil
+		}
+		target, peeled := r.peelLooseTag(value)
+		if !peeled {
+			ok = false
+		} else if target == oid {
+			found[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for tag := range found {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, ok, nil
+}
+
+// peelLooseTag returns the object an annotated tag points to, or oid itself
+// when it is not a tag. It only reads loose objects, peeled is false when the
+// object is packed.
+func (r *Repo) peelLooseTag(oid string) (target string, peeled bool) {
+	for depth := 0; depth < 5; depth++ {
+		if len(oid) < 3 {
+			return "", false
+		}
+		f, err := os.Open(filepath.Join(r.CommonDir, "objects", oid[:2], oid[2:]))
+		if err != nil {
+			return "", false
+		}
+		zr, err := zlib.NewReader(f)
+		if err != nil {
+			f.Close()
+			return "", false
+		}
+		// The header and the first lines of a tag object are all that is
+		// needed.
+		head := make([]byte, 128)
+		n, _ := io.ReadFull(zr, head)
+		zr.Close()
+		f.Close()
+
+		header, body, found := bytes.Cut(head[:n], []byte{0})
+		if !found {
+			return "", false
+		}
+		if !bytes.HasPrefix(header, []byte("tag ")) {
+			return oid, true
+		}
+
+		lines := bytes.SplitN(body, []byte("\n"), 3)
+		if len(lines) < 3 {
+			return "", false
+		}
+		next, isObject := bytes.CutPrefix(lines[0], []byte("object "))
+		nextType, isType := bytes.CutPrefix(lines[1], []byte("type "))
+		if !isObject || !isType {
+			return "", false
+		}
+		oid = string(next)
+		if string(nextType) != "tag" {
+			return oid, true
+		}
+	}
+	return "", false
+}
+
+// StashCount returns the number of stash entries, read from the refs/stash
+// reflog.
+func (r *Repo) StashCount() (int, error) {
+	b, err := os.ReadFile(filepath.Join(r.CommonDir, "logs", "refs", "stash"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strings.Count(string(b), "\n"), nil
+}
@@ -0,0 +1,299 @@
+package gitdir
+
+import (
+	"bytes"
+	"compress/zlib"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindHead(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main/.git/HEAD":            "ref: refs/heads/feature\n",
+		"main/.git/refs/heads/main": "1111111111111111111111111111111111111111\n",
+		"main/.git/packed-refs": "# pack-refs with: peeled fully-peeled sorted\n" +
+			"2222222222222222222222222222222222222222 refs/heads/feature\n" +
+			"3333333333333333333333333333333333333333 refs/tags/v1.0.0\n" +
+			"^1111111111111111111111111111111111111111\n",
+		"main/sub/dir/file": "",
+		"main/.git/logs/refs/stash": "0000000000000000000000000000000000000000 4444444444444444444444444444444444444444 a <a@b> 1 +0000\tWIP on main\n" +
+			"4444444444444444444444444444444444444444 5555555555555555555555555555555555555555 a <a@b> 2 +0000\tWIP on main\n",
+
+		"main/.git/worktrees/wt/HEAD":      "1111111111111111111111111111111111111111\n",
+		"main/.git/worktrees/wt/commondir": "../..\n",
+		"wt/.git":                          "gitdir: ../main/.git/worktrees/wt\n",
+	})
+
+	repo, err := Find(filepath.Join(root, "main", "sub", "dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.WorkTree != filepath.Join(root, "main") || repo.GitDir != repo.CommonDir {
+		t.Errorf("Find() = %+v", repo)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Branch() != "feature" || head.OID != "2222222222222222222222222222222222222222" {
+		t.Errorf("Head() = %+v", head)
+	}
+
+	packed, err := repo.PackedRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packed["refs/tags/v1.0.0^{}"] != "1111111111111111111111111111111111111111" {
+		t.Errorf("PackedRefs() = %v", packed)
+	}
+
+	if n, err := repo.StashCount(); err != nil || n != 2 {
+		t.Errorf("StashCount() = %v, %v", n, err)
+	}
+
+	wt, err := Find(filepath.Join(root, "wt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wt.GitDir != filepath.Join(root, "main", ".git", "worktrees", "wt") || wt.CommonDir != filepath.Join(root, "main", ".git") {
+		t.Errorf("Find() = %+v", wt)
+	}
+
+	wtHead, err := wt.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wtHead.Detached() || wtHead.OID != "1111111111111111111111111111111111111111" {
+		t.Errorf("Head() = %+v", wtHead)
+	}
+
+	if oid, err := wt.ResolveRef("refs/heads/main"); err != nil || oid != "1111111111111111111111111111111111111111" {
+		t.Errorf("ResolveRef() = %v, %v", oid, err)
+	}
+	if n, err := wt.StashCount(); err != nil || n != 2 {
+		t.Errorf("StashCount() = %v, %v", n, err)
+	}
+}
+
+func TestFindLayout(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"bare.git/HEAD":               "ref: refs/heads/main\n",
+		"bare.git/config":             "[core]\n\tbare = true\n",
+		"bare.git/objects/info/packs": "",
+		"bare.git/refs/heads/main":    "1111111111111111111111111111111111111111\n",
+
+		"bare.git/worktrees/feature/HEAD":      "ref: refs/heads/feature\n",
+		"bare.git/worktrees/feature/commondir": "../..\n",
+		"feature/.git":                         "gitdir: ../bare.git/worktrees/feature\n",
+
+		"super/.git/HEAD":                    "ref: refs/heads/main\n",
+		"super/.git/config":                  "[core]\n\tbare = false\n",
+		"super/.git/objects/info/packs":      "",
+		"super/.git/refs/heads/main":         "1111111111111111111111111111111111111111\n",
+		"super/.git/modules/lib/HEAD":        "1111111111111111111111111111111111111111\n",
+		"super/.git/modules/lib/refs/tags":   "",
+		"super/.git/modules/lib/objects/x":   "",
+		"super/.gitmodules":                  "[submodule \"vendor\"]\n\tpath = third_party/vendor\n",
+		"super/lib/.git":                     "gitdir: ../.git/modules/lib\n",
+		"super/third_party/vendor/.git/HEAD": "1111111111111111111111111111111111111111\n",
+		"super/nested/.git/HEAD":             "1111111111111111111111111111111111111111\n",
+	})
+
+	for _, tc := range []struct {
+		dir          string
+		workTree     string
+		bare         bool
+		worktree     string
+		superproject string
+	}{
+		{dir: "bare.git/refs/heads", bare: true},
+		{dir: "bare.git/worktrees/feature", worktree: "feature"},
+		{dir: "feature", workTree: "feature", worktree: "feature"},
+		{dir: "super/.git/refs", bare: false},
+		{dir: "super/lib", workTree: "super/lib", superproject: "super"},
+		{dir: "super/third_party/vendor", workTree: "super/third_party/vendor", superproject: "super"},
+		{dir: "super/nested", workTree: "super/nested"},
+	} {
+		repo, err := Find(filepath.Join(root, tc.dir))
+		if err != nil {
+			t.Errorf("Find(%v) = %v", tc.dir, err)
+			continue
+		}
+
+		workTree, superproject := "", ""
+		if tc.workTree != "" {
+			workTree = filepath.Join(root, tc.workTree)
+		}
+		if tc.superproject != "" {
+			superproject = filepath.Join(root, tc.superproject)
+		}
+
+		if repo.WorkTree != workTree || repo.Bare != tc.bare {
+			t.Errorf("Find(%v) = %+v", tc.dir, repo)
+		}
+		if got := repo.LinkedWorktree(); got != tc.worktree {
+			t.Errorf("Find(%v).LinkedWorktree() = %q, want %q", tc.dir, got, tc.worktree)
+		}
+		if got := repo.Superproject(); got != superproject {
+			t.Errorf("Find(%v).Superproject() = %q, want %q", tc.dir, got, superproject)
+		}
+	}
+}
+
+func TestFindNotFound(t *testing.T) {
+	if _, err := Find(t.TempDir()); err == nil {
+		t.Error("Find() outside of a repository succeeded")
+	}
+}
+
+func TestTagsAt(t *testing.T) {
+	const (
+		commit = "1111111111111111111111111111111111111111"
+		other  = "2222222222222222222222222222222222222222"
+		tagObj = "3333333333333333333333333333333333333333"
+	)
+
+	looseObject := func(content string) string {
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		zw.Write([]byte(content))
+		zw.Close()
+		return b.String()
+	}
+
+	gitDir := t.TempDir()
+	writeFiles(t, gitDir, map[string]string{
+		"packed-refs": "# pack-refs with: peeled fully-peeled sorted\n" +
+			"4444444444444444444444444444444444444444 refs/tags/v1\n" +
+			"^" + commit + "\n" +
+			other + " refs/tags/v2\n" +
+			commit + " refs/tags/moved\n",
+		"refs/tags/moved":             other + "\n",
+		"refs/tags/light":             commit + "\n",
+		"refs/tags/v3":                tagObj + "\n",
+		"objects/33/" + tagObj[2:]:    looseObject("tag 123\x00object " + commit + "\ntype commit\ntag v3\n"),
+		"objects/22/" + other[2:]:     looseObject("commit 123\x00tree 0000\n"),
+		"refs/tags/release/candidate": commit + "\n",
+	})
+	repo := &Repo{GitDir: gitDir, CommonDir: gitDir}
+
+	tags, ok, err := repo.TagsAt(commit)
+	if err != nil || !ok || strings.Join(tags, ",") != "light,release/candidate,v1,v3" {
+		t.Errorf("TagsAt() = %v, %v, %v", tags, ok, err)
+	}
+
+	// A tag object that is not loose can not be peeled.
+	writeFiles(t, gitDir, map[string]string{"refs/tags/v4": "5555555555555555555555555555555555555555\n"})
+	if _, ok, err := repo.TagsAt(commit); err != nil || ok {
+		t.Errorf("TagsAt() = _, %v, %v", ok, err)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		files map[string]string
+		want  *Operation
+	}{
+		{
+			name:  "none",
+			files: map[string]string{},
+			want:  nil,
+		},
+		{
+			name: "rebase-merge",
+			files: map[string]string{
+				"rebase-merge/orig-head": "abc\n",
+				"rebase-merge/head-name": "refs/heads/feature\n",
+				"rebase-merge/msgnum":    "2\n",
+				"rebase-merge/end":       "5\n",
+			},
+			want: &Operation{Name: "rebase", Step: 2, Total: 5, Left: 4, Head: "abc", HeadName: "refs/heads/feature"},
+		},
+		{
+			name: "rebase-merge without msgnum",
+			files: map[string]string{
+				"rebase-merge/done":            "pick a one\npick b two\n",
+				"rebase-merge/git-rebase-todo": "pick c three\n\n# Commands:\n# p, pick <commit> = use commit\n",
+			},
+			want: &Operation{Name: "rebase", Step: 2, Total: 3, Left: 2},
+		},
+		{
+			name: "am",
+			files: map[string]string{
+				"rebase-apply/applying": "",
+				"rebase-apply/next":     "1\n",
+				"rebase-apply/last":     "3\n",
+			},
+			want: &Operation{Name: "am", Step: 1, Total: 3, Left: 3},
+		},
+		{
+			name: "rebase-apply",
+			files: map[string]string{
+				"rebase-apply/rebasing":  "",
+				"rebase-apply/head-name": "refs/heads/feature\n",
+				"rebase-apply/next":      "3\n",
+				"rebase-apply/last":      "3\n",
+			},
+			want: &Operation{Name: "rebase", Step: 3, Total: 3, Left: 1, HeadName: "refs/heads/feature"},
+		},
+		{
+			name: "merge",
+			files: map[string]string{
+				"MERGE_HEAD": "abc\ndef\n",
+			},
+			want: &Operation{Name: "merge", Head: "abc"},
+		},
+		{
+			name: "cherry-pick sequence",
+			files: map[string]string{
+				"CHERRY_PICK_HEAD": "abc\n",
+				"sequencer/todo":   "pick abc one\npick def two\n",
+			},
+			want: &Operation{Name: "cherry", Left: 2, Head: "abc"},
+		},
+		{
+			name: "revert between commits",
+			files: map[string]string{
+				"sequencer/todo": "revert def two\n",
+			},
+			want: &Operation{Name: "revert", Left: 1},
+		},
+		{
+			name: "bisect",
+			files: map[string]string{
+				"BISECT_LOG": "git bisect start\n",
+			},
+			want: &Operation{Name: "bisect"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gitDir := t.TempDir()
+			writeFiles(t, gitDir, tc.files)
+
+			repo := &Repo{GitDir: gitDir, CommonDir: gitDir}
+			got := repo.Operation()
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("Operation() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package gitdir
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Operation is a multi step operation (rebase, merge, ...) in progress.
+type Operation struct {
+	// Name is one of rebase, am, am/rebase, merge, cherry, revert or bisect.
+	Name string
+
+	// Step and Total are the position within the operation, both are zero
+	// when unknown.
+	Step  int
+	Total int
+	// Left is the number of actions left including the current one, zero
+	// when unknown.
+	Left int
+
+	// Head is the commit being applied (merged, picked, ...) or the commit
+	// the rebased branch pointed to.
+	Head string
+	// HeadName is the ref being rebased (e.g. refs/heads/feature).
+	HeadName string
+}
+
+// Operation returns the operation in progress in the worktree, or nil.
+func (r *Repo) Operation() *Operation {
+	if op := r.rebaseMergeOperation(); op != nil {
+		return op
+	}
+	if op := r.rebaseApplyOperation(); op != nil {
+		return op
+	}
+	if head := r.readFile("MERGE_HEAD"); head != "" {
+		return &Operation{Name: "merge", Head: firstLine(head)}
+	}
+	if op := r.sequencerOperation(); op != nil {
+		return op
+	}
+	if r.exists("BISECT_LOG") {
+		return &Operation{Name: "bisect"}
+	}
+	return nil
+}
+
+// rebaseMergeOperation handles the merge backend of rebase (the default and
+// interactive rebase).
+func (r *Repo) rebaseMergeOperation() *Operation {
+	if !r.exists("rebase-merge") {
+		return nil
+	}
+
+	op := &Operation{
+		Name:     "rebase",
+		Head:     r.readFile("rebase-merge/orig-head"),
+		HeadName: r.readFile("rebase-merge/head-name"),
+	}
+
+	op.Step, _ = strconv.Atoi(r.readFile("rebase-merge/msgnum"))
+	op.Total, _ = strconv.Atoi(r.readFile("rebase-merge/end"))
+	if op.Total == 0 {
+		done := countTodo(r.readFile("rebase-merge/done"))
+		todo := countTodo(r.readFile("rebase-merge/git-rebase-todo"))
+		op.Step, op.Total = done, done+todo
+	}
+	if op.Total > 0 {
+		op.Left = op.Total - op.Step + 1
+	}
+
+	return op
+}
+
+// rebaseApplyOperation handles both `git am` and the apply backend of rebase.
+func (r *Repo) rebaseApplyOperation() *Operation {
+	if !r.exists("rebase-apply") {
+		return nil
+	}
+
+	op := &Operation{Name: "am/rebase"}
+	if r.exists("rebase-apply/rebasing") {
+		op.Name = "rebase"
+		op.Head = r.readFile("rebase-apply/orig-head")
+		op.HeadName = r.readFile("rebase-apply/head-name")
+	} else if r.exists("rebase-apply/applying") {
+		op.Name = "am"
+	}
+
+	op.Step, _ = strconv.Atoi(r.readFile("rebase-apply/next"))
+	op.Total, _ = strconv.Atoi(r.readFile("rebase-apply/last"))
+	if op.Total > 0 {
+		op.Left = op.Total - op.Step + 1
+	}
+
+	return op
+}
+
+// sequencerOperation handles (possibly multi commit) cherry-pick and revert.
+func (r *Repo) sequencerOperation() *Operation {
+	todo := r.readFile("sequencer/todo")
+
+	var op *Operation
+	if head := r.readFile("CHERRY_PICK_HEAD"); head != "" {
+		op = &Operation{Name: "cherry", Head: firstLine(head)}
+	} else if head := r.readFile("REVERT_HEAD"); head != "" {
+		op = &Operation{Name: "revert", Head: firstLine(head)}
+	} else if todo != "" {
+		// Between picks, e.g. after committing a conflict resolution and
+		// before `--continue`.
+		action, _, _ := strings.Cut(firstLine(todo), " ")
+		switch action {
+		case "pick", "p":
+			op = &Operation{Name: "cherry"}
+		case "revert":
+			op = &Operation{Name: "revert"}
+		default:
+			return nil
+		}
+	} else {
+		return nil
+	}
+
+	op.Left = countTodo(todo)
+	return op
+}
+
+func (r *Repo) exists(name string) bool {
+	_, err := os.Stat(filepath.Join(r.GitDir, filepath.FromSlash(name)))
+	return err == nil
+}
+
+func (r *Repo) readFile(name string) string {
+	b, _ := os.ReadFile(filepath.Join(r.GitDir, filepath.FromSlash(name)))
+	return strings.TrimSpace(string(b))
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(line)
+}
+
+// countTodo counts the actions in a sequencer todo/done list, skipping blank
+// lines and comments.
+func countTodo(s string) int {
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewBufferString(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		n++
+	}
+	return n
+}
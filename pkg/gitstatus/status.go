@@ -0,0 +1,150 @@
+// Package gitstatus parses the output of
+// `git status --porcelain=v2 --branch -z`.
+package gitstatus
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Args are the git arguments producing output understood by Parse.
+var Args = []string{"status", "--porcelain=v2", "--branch", "-z"}
+
+type Status struct {
+	// OID is the commit checked out, empty for a repository without commits.
+	OID string
+	// Head is the checked out branch, empty when HEAD is detached.
+	Head     string
+	Detached bool
+
+	Upstream string
+	// Ahead and Behind are only set when the upstream exists.
+	HasAheadBehind bool
+	Ahead          int
+	Behind         int
+
+	// Entries is the number of changed paths, each path is counted in one
+	// or more of the categories below.
+	Entries int
+
+	Staged     int
+	Unstaged   int
+	Untracked  int
+	Conflicted int
+	Renamed    int
+}
+
+// Dirty reports if there are any changes in the index or working tree.
+func (s *Status) Dirty() bool {
+	return s.Entries > 0
+}
+
+// Parse parses NUL separated porcelain v2 status output.
+func Parse(out []byte) (*Status, error) {
+	s := &Status{}
+
+	fields := bytes.Split(out, []byte{0})
+	for i := 0; i < len(fields); i++ {
+		line := string(fields[i])
+		if len(line) == 0 {
+			continue
+		}
+
+		switch line[0] {
+		case '#':
+			if err := s.parseHeader(line); err != nil {
+				return nil, err
+			}
+
+		case '1':
+			if err := s.parseChanged(line, 9); err != nil {
+				return nil, err
+			}
+
+		case '2':
+			if err := s.parseChanged(line, 10); err != nil {
+				return nil, err
+			}
+			s.Renamed++
+			// The original path follows as a separate field.
+			i++
+
+		case 'u':
+			if len(strings.SplitN(line, " ", 11)) < 11 {
+				return nil, fmt.Errorf("gitstatus: malformed unmerged entry %q", line)
+			}
+			s.Entries++
+			s.Conflicted++
+
+		case '?':
+			s.Entries++
+			s.Untracked++
+
+		case '!':
+			// Ignored files are only listed with --ignored.
+
+		default:
+			return nil, fmt.Errorf("gitstatus: unknown entry %q", line)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Status) parseHeader(line string) error {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 3 {
+		return nil
+	}
+	key, value := parts[1], parts[2]
+
+	switch key {
+	case "branch.oid":
+		if value != "(initial)" {
+			s.OID = value
+		}
+
+	case "branch.head":
+		if value == "(detached)" {
+			s.Detached = true
+		} else {
+			s.Head = value
+		}
+
+	case "branch.upstream":
+		s.Upstream = value
+
+	case "branch.ab":
+		var err error
+		ahead, behind, _ := strings.Cut(value, " ")
+		if s.Ahead, err = strconv.Atoi(strings.TrimPrefix(ahead, "+")); err != nil {
+			return fmt.Errorf("gitstatus: malformed %q: %w", line, err)
+		}
+		if s.Behind, err = strconv.Atoi(strings.TrimPrefix(behind, "-")); err != nil {
+			return fmt.Errorf("gitstatus: malformed %q: %w", line, err)
+		}
+		s.HasAheadBehind = true
+	}
+
+	return nil
+}
+
+func (s *Status) parseChanged(line string, nFields int) error {
+	parts := strings.SplitN(line, " ", nFields)
+	if len(parts) < nFields || len(parts[1]) != 2 {
+		return fmt.Errorf("gitstatus: malformed entry %q", line)
+	}
+
+	xy := parts[1]
+	if xy[0] != '.' {
+		s.Staged++
+	}
+	if xy[1] != '.' {
+		s.Unstaged++
+	}
+	s.Entries++
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package gitstatus
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	out := strings.Join([]string{
+		"# branch.oid 53e7a9b5f10598928add31129564dc3bea446d2a",
+		"# branch.head main",
+		"# branch.upstream origin/main",
+		"# branch.ab +2 -1",
+		"2 R. N... 100644 100644 100644 7898192 7898192 R100 a2", "a",
+		"1 MM N... 100644 100644 100644 6178079 0505b3b b",
+		"1 .M N... 100644 100644 100644 f2ad6c7 f2ad6c7 with space",
+		"u UU N... 100644 100644 100644 100644 1111111 2222222 3333333 conflict",
+		"? untracked",
+		"",
+	}, "\x00")
+
+	s, err := Parse([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Status{
+		OID:            "53e7a9b5f10598928add31129564dc3bea446d2a",
+		Head:           "main",
+		Upstream:       "origin/main",
+		HasAheadBehind: true,
+		Ahead:          2,
+		Behind:         1,
+		Entries:        5,
+		Staged:         2,
+		Unstaged:       2,
+		Untracked:      1,
+		Conflicted:     1,
+		Renamed:        1,
+	}
+	if *s != want {
+		t.Errorf("Parse() = %+v, want %+v", *s, want)
+	}
+}
+
+func TestParseDetached(t *testing.T) {
+	s, err := Parse([]byte("# branch.oid (initial)\x00# branch.head (detached)\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Detached || s.Head != "" || s.OID != "" || s.Dirty() {
+		t.Errorf("Parse() = %+v", *s)
+	}
+}
@@ -18,6 +18,7 @@ type Cmd struct {
 	stdout io.Writer
 
 	env []string
+	dir string
 
 	cmd *exec.Cmd
 }
@@ -65,6 +66,12 @@ func EnvInherit() Option {
 	}
 }
 
+func Dir(dir string) Option {
+	return func(ex *Cmd) {
+		ex.dir = dir
+	}
+}
+
 func BindStderr(b io.Writer) Option {
 	return func(ex *Cmd) {
 		ex.stderr = b
@@ -134,6 +141,7 @@ func New(ctx context.Context, options ...Option) *Cmd {
 	cmd.Stdout = ex.stdout
 	cmd.Stderr = ex.stderr
 	cmd.Env = ex.env
+	cmd.Dir = ex.dir
 
 	ex.cmd = cmd
 
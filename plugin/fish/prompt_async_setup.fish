@@ -79,7 +79,7 @@ function _fish_async_prompt_start_async_work
     env \
         _FISH_ASYNC_PROMPT_EXEC=$_fish_async_prompt_exec \
         _FISH_ASYNC_PROMPT_STATE_VAR_REF=$_fish_async_prompt_state_var_name \
-        _FISH_ASYNC_PROMPT_LAST_CMD_STATUS=$_fish_async_last_cmd_status \
+        _FISH_ASYNC_PROMPT_LAST_CMD_STATUS="$_fish_async_last_cmd_status" \
         _FISH_ASYNC_PROMPT_LAST_CMD_PREEXEC_TS_EPOCH=$_fish_async_last_cmd_preexec_ts_epoch \
         fish --private --command "$_fish_async_prompt_script" &
     set --global _fish_async_prompt_state_job_pid $last_pid
@@ -93,11 +93,15 @@ function _fish_async_prompt_update --on-event fish_prompt
     _fish_async_prompt_start_async_work
 end
 
-function _fish_async_prompt_update_last_cmd_status --on-event fish_preexec
-    set --global _fish_async_last_cmd_status $status
+function _fish_async_prompt_update_last_cmd_preexec_ts --on-event fish_preexec
     set --global _fish_async_last_cmd_preexec_ts_epoch (date +%s)
 end
 
+# Status of each command of the last pipeline, passed on space separated.
+function _fish_async_prompt_update_last_cmd_status --on-event fish_postexec
+    set --global _fish_async_last_cmd_status $pipestatus
+end
+
 # ------------------------------------------------------------------------------
 
 # Main prompt function